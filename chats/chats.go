@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"suah.dev/mcchunkie/chats/format"
 	"suah.dev/mcchunkie/mcstore"
 	"suah.dev/mcchunkie/plugins"
 )
@@ -11,9 +12,39 @@ import (
 // Chat represents a mode of communication like Matrix, IRC or SMS.
 type Chat interface {
 	// Connect connects
-	Connect(*mcstore.MCStore, *plugins.Plugins) error
+	Connect(*mcstore.MCStore, *Dispatcher) error
 	Name() string
-	Send(to string, message string) error
+	// Send sends a markdown message to a room or person. It returns the
+	// ID of the message, which is empty for chats that can't edit
+	// messages.
+	Send(to string, message string) (string, error)
+	// Format is the formatting the chat can display.
+	Format() format.Format
+	// Limits is how much the chat can send at once.
+	Limits() format.Limits
+}
+
+// render renders resp as text in the format f. Markdown responses are
+// converted (see format.Render), everything else is left as is.
+func render(f format.Format, resp *plugins.Response) string {
+	switch resp.Kind {
+	case plugins.KindMarkdown, plugins.KindNotice:
+		return format.Render(f, resp.Text)
+	}
+	return resp.String()
+}
+
+// split renders resp for c and splits it to fit (see format.Split).
+func split(c Chat, resp *plugins.Response) format.Chunks {
+	return format.Split(render(c.Format(), resp), c.Limits())
+}
+
+// unpaged returns the limits of c without MaxLines. Messages nobody asked
+// for, like scheduled ones, are sent in full as nobody could ask for more.
+func unpaged(c Chat) format.Limits {
+	l := c.Limits()
+	l.MaxLines = 0
+	return l
 }
 
 // Chats is a collection of our chat methods. An instance of this is iterated
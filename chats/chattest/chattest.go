@@ -0,0 +1,230 @@
+// Package chattest provides a fake chat and an in-memory store for testing
+// plugins through the real dispatcher.
+package chattest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"suah.dev/mcchunkie/chats"
+	"suah.dev/mcchunkie/chats/format"
+	"suah.dev/mcchunkie/mcstore"
+	"suah.dev/mcchunkie/plugins"
+)
+
+// Store is an in-memory plugins.PluginStore.
+type Store struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+// NewStore creates a Store holding data.
+func NewStore(data map[string]string) *Store {
+	s := &Store{data: map[string]string{}}
+	for k, v := range data {
+		s.data[k] = v
+	}
+	return s
+}
+
+// Set sets key to value
+func (s *Store) Set(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+// Get returns the value of key, or an error if it doesn't exist
+func (s *Store) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	if !ok {
+		return "", fmt.Errorf("no entry for %q", key)
+	}
+	return v, nil
+}
+
+// Scrub holds replacements applied to responses before they are added to
+// the transcript. It hides things that change from run to run.
+var Scrub = map[*regexp.Regexp]string{
+	regexp.MustCompile(`\w{3}, \d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2} \w+`): "<time>",
+}
+
+// Chat is a fake chat. Messages sent with Say are run through the
+// dispatcher and everything is written to a transcript.
+type Chat struct {
+	// Context is the template for incoming messages. Chat, BotName and
+	// Room default to "Test", "mcchunkie" and "#test".
+	Context plugins.MessageContext
+	// MaxLines, if set, is the number of lines of a response shown, the
+	// rest is held back for "more".
+	MaxLines int
+
+	Store *Store
+	d     *chats.Dispatcher
+
+	mu         sync.Mutex
+	transcript []string
+	sent       int
+}
+
+// New creates a Chat for plugs.
+func New(plugs plugins.Plugins) (*Chat, error) {
+	c := &Chat{
+		Context: plugins.MessageContext{
+			Chat:    "Test",
+			BotName: "mcchunkie",
+			Room:    "#test",
+		},
+		Store: NewStore(nil),
+	}
+	d, err := chats.NewDispatcher(c.Store, plugs)
+	if err != nil {
+		return nil, err
+	}
+	return c, c.Connect(nil, d)
+}
+
+// Connect sets the dispatcher. The store is ignored in favor of Store.
+func (c *Chat) Connect(_ *mcstore.MCStore, d *chats.Dispatcher) error {
+	c.d = d
+	return nil
+}
+
+// Format is markdown, transcripts show what plugins produce.
+func (c *Chat) Format() format.Format {
+	return format.Markdown
+}
+
+// Limits only limits the number of lines, see MaxLines.
+func (c *Chat) Limits() format.Limits {
+	return format.Limits{Multiline: true, MaxLines: c.MaxLines}
+}
+
+// Name returns the chat name used for incoming messages.
+func (c *Chat) Name() string {
+	return c.Context.Chat
+}
+
+// Send records a message sent outside of a conversation.
+func (c *Chat) Send(to string, message string) (string, error) {
+	c.record("< %s: %s", to, message)
+	return "", nil
+}
+
+func (c *Chat) record(format string, a ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transcript = append(c.transcript, fmt.Sprintf(format, a...))
+}
+
+// Say sends msg from sender and waits for all responses, delayed ones
+// included. If Context.Edits is set responses are numbered and edits show
+// the number of the response they replace.
+func (c *Chat) Say(sender, msg string) {
+	mc := c.Context
+	mc.Sender = sender
+	if mc.Direct {
+		mc.Room = sender
+	}
+
+	c.record("> %s: %s", sender, msg)
+	c.d.Dispatch(&mc, msg, func(resp *plugins.Response) (string, error) {
+		chunks := format.Split(resp.Text, c.Limits())
+		c.d.Pager.Hold(&mc, resp.Kind, chunks.Rest)
+		text := strings.Join(chunks.Messages, "\n")
+		for re, repl := range Scrub {
+			text = re.ReplaceAllString(text, repl)
+		}
+		if len(resp.Image) > 0 {
+			text = fmt.Sprintf("%s (%d bytes)", text, len(resp.Image))
+		}
+		lines := strings.Split(text, "\n")
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		var id string
+		switch {
+		case !mc.Edits:
+			lines[0] = fmt.Sprintf("< %s: %s", resp.Kind, lines[0])
+		case resp.Edit != "":
+			id = resp.Edit
+			lines[0] = fmt.Sprintf("< edit %s %s: %s", id, resp.Kind, lines[0])
+		default:
+			c.sent++
+			id = fmt.Sprintf("#%d", c.sent)
+			lines[0] = fmt.Sprintf("< %s %s: %s", id, resp.Kind, lines[0])
+		}
+		c.transcript = append(c.transcript, lines[0])
+		for _, l := range lines[1:] {
+			c.transcript = append(c.transcript, strings.TrimSpace("< "+l))
+		}
+		return id, nil
+	})
+	c.d.Wait()
+}
+
+// Transcript returns everything said so far.
+func (c *Chat) Transcript() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.Join(c.transcript, "\n") + "\n"
+}
+
+// Run plays a script. Lines starting with "> sender: " are messages,
+// "= key value" sets a store value and "@ field value" changes Context
+// (chat, room, bot, direct or edits) or MaxLines (lines). Blank lines and
+// lines starting with "#" are copied to the transcript.
+func (c *Chat) Run(script io.Reader) error {
+	scanner := bufio.NewScanner(script)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			c.record("%s", line)
+		case strings.HasPrefix(line, "> "):
+			sender, msg, ok := strings.Cut(line[2:], ": ")
+			if !ok {
+				return fmt.Errorf("invalid message: %q", line)
+			}
+			c.Say(sender, msg)
+		case strings.HasPrefix(line, "= "):
+			key, value, _ := strings.Cut(line[2:], " ")
+			c.Store.Set(key, value)
+			c.record("%s", line)
+		case strings.HasPrefix(line, "@ "):
+			field, value, _ := strings.Cut(line[2:], " ")
+			switch field {
+			case "chat":
+				c.Context.Chat = value
+			case "room":
+				c.Context.Room = value
+			case "bot":
+				c.Context.BotName = value
+			case "direct":
+				c.Context.Direct = value == "true"
+			case "edits":
+				c.Context.Edits = value == "true"
+			case "lines":
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("invalid number of lines: %q", value)
+				}
+				c.MaxLines = n
+			default:
+				return fmt.Errorf("unknown field: %q", field)
+			}
+			c.record("%s", line)
+		default:
+			return fmt.Errorf("invalid line: %q", line)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,56 @@
+package chattest
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"suah.dev/mcchunkie/plugins"
+)
+
+var update = flag.Bool("update", false, "update golden transcripts")
+
+// TestTranscripts plays each testdata/*.script and compares the transcript
+// with the matching .golden file.
+func TestTranscripts(t *testing.T) {
+	scripts, err := filepath.Glob("testdata/*.script")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, script := range scripts {
+		name := strings.TrimSuffix(filepath.Base(script), ".script")
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			c, err := New(plugins.NewPlugs())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Run(f); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := strings.TrimSuffix(script, ".script") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(c.Transcript()), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Transcript(); got != string(want) {
+				t.Errorf("transcript differs from %s, got:\n%s", golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,547 @@
+package chats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"suah.dev/mcchunkie/plugins"
+)
+
+// MatchMode decides how many plugins get to answer a single message.
+type MatchMode int
+
+const (
+	// AllMatch lets every matching plugin respond.
+	AllMatch MatchMode = iota
+	// FirstMatch stops after the first plugin that responds.
+	FirstMatch
+)
+
+// DefaultModes are the match modes used for each chat. Chats not listed
+// here use AllMatch. IRC, Mail and SMS only ever send one reply per message
+// to keep from flooding channels, inboxes and phone bills.
+var DefaultModes = map[string]MatchMode{
+	"IRC":  FirstMatch,
+	"Mail": FirstMatch,
+	"SMS":  FirstMatch,
+}
+
+const (
+	// DefaultTimeout is how long plugins get to respond, it can be
+	// changed with "plugin_timeout".
+	DefaultTimeout = 30 * time.Second
+	// DefaultSlowAfter is when we tell people a plugin is still working,
+	// it can be changed with "plugin_slow_after".
+	DefaultSlowAfter = 5 * time.Second
+	// DefaultWorkers is the number of messages handled at once for each
+	// chat, it can be changed with "chat_workers".
+	DefaultWorkers = 4
+	// DefaultQueueSize is the number of messages that can wait for a
+	// worker before new ones are dropped.
+	DefaultQueueSize = 64
+)
+
+// Replier sends a plugin response back to where a message came from. It
+// returns the ID of the message sent, if the chat can edit it later (see
+// plugins.MessageContext.Edits). Responses with Edit set replace that
+// message.
+type Replier func(resp *plugins.Response) (string, error)
+
+// Dispatcher hands incoming messages to plugins. Chats translate their
+// transport events into calls to Dispatch.
+type Dispatcher struct {
+	Store   plugins.PluginStore
+	Plugins plugins.Plugins
+	Modes   map[string]MatchMode
+
+	Timeout   time.Duration
+	SlowAfter time.Duration
+	Workers   int
+	QueueSize int
+
+	// Breaker disables plugins that keep failing.
+	Breaker *plugins.Breaker
+	// Limiter keeps people from using plugins too often.
+	Limiter *plugins.RateLimiter
+	// Pager holds the lines chats couldn't fit in a reply.
+	Pager *plugins.Pager
+	// Bridges keeps messages that arrive in several bridged rooms from
+	// being answered more than once.
+	Bridges *plugins.Bridges
+	// Report, if set, is called with messages for the bot owners, like
+	// plugins crashing or being disabled.
+	Report func(msg string)
+
+	poolsMu sync.Mutex
+	pools   map[string]chan func()
+
+	pending   sync.WaitGroup
+	scheduler *plugins.Scheduler
+
+	// timersMu guards timers and closed, no timers are started once the
+	// Dispatcher is closed.
+	timersMu sync.Mutex
+	timers   map[*time.Timer]bool
+	closed   bool
+}
+
+// NewDispatcher creates a Dispatcher for plugs. Plugins get their own part
+// of store (see plugins.Scoped). They are consulted in order of their
+// Priority (see plugins.Prioritizer), ties keep the order of plugs. An
+// error is returned if any of the plugins have an invalid regular
+// expression.
+func NewDispatcher(store plugins.PluginStore, plugs plugins.Plugins) (*Dispatcher, error) {
+	if err := plugs.Compile(); err != nil {
+		return nil, err
+	}
+
+	d := &Dispatcher{
+		Store:     store,
+		Plugins:   make(plugins.Plugins, len(plugs)),
+		Modes:     DefaultModes,
+		Timeout:   DefaultTimeout,
+		SlowAfter: DefaultSlowAfter,
+		Workers:   DefaultWorkers,
+		QueueSize: DefaultQueueSize,
+		Breaker:   plugins.NewBreaker(plugins.DefaultBreakerThreshold, plugins.DefaultBreakerCooldown),
+		Limiter:   plugins.NewRateLimiter(),
+		Pager:     plugins.NewPager(nil),
+		Bridges:   plugins.NewBridges(plugins.DefaultBridgeWindow),
+		pools:     map[string]chan func(){},
+		timers:    map[*time.Timer]bool{},
+	}
+	copy(d.Plugins, plugs)
+
+	if t, err := store.Get("plugin_timeout"); err == nil && t != "" {
+		if d.Timeout, err = time.ParseDuration(t); err != nil {
+			return nil, fmt.Errorf("plugin_timeout: %w", err)
+		}
+	}
+	if t, err := store.Get("plugin_slow_after"); err == nil && t != "" {
+		if d.SlowAfter, err = time.ParseDuration(t); err != nil {
+			return nil, fmt.Errorf("plugin_slow_after: %w", err)
+		}
+	}
+	if w, err := store.Get("chat_workers"); err == nil && w != "" {
+		if d.Workers, err = strconv.Atoi(w); err != nil || d.Workers < 1 {
+			return nil, fmt.Errorf("chat_workers: invalid number of workers: %q", w)
+		}
+	}
+	if t, err := store.Get("more_expiry"); err == nil && t != "" {
+		if d.Pager.Expiry, err = time.ParseDuration(t); err != nil {
+			return nil, fmt.Errorf("more_expiry: %w", err)
+		}
+	}
+	if p, err := store.Get("more_persist"); err == nil && p == "true" {
+		d.Pager.Store = store
+	}
+	if t, err := store.Get("bridge_window"); err == nil && t != "" {
+		if d.Bridges.Window, err = time.ParseDuration(t); err != nil {
+			return nil, fmt.Errorf("bridge_window: %w", err)
+		}
+	}
+	if t, err := store.Get("breaker_threshold"); err == nil && t != "" {
+		if d.Breaker.Threshold, err = strconv.Atoi(t); err != nil || d.Breaker.Threshold < 1 {
+			return nil, fmt.Errorf("breaker_threshold: invalid number of failures: %q", t)
+		}
+	}
+	if t, err := store.Get("breaker_cooldown"); err == nil && t != "" {
+		if d.Breaker.Cooldown, err = time.ParseDuration(t); err != nil {
+			return nil, fmt.Errorf("breaker_cooldown: %w", err)
+		}
+	}
+
+	sort.SliceStable(d.Plugins, func(i, j int) bool {
+		return plugins.Priority(d.Plugins[i]) > plugins.Priority(d.Plugins[j])
+	})
+
+	for _, p := range d.Plugins {
+		p.SetStore(plugins.Scoped(store, p))
+		if b, ok := p.(plugins.BreakerUser); ok {
+			b.SetBreaker(d.Breaker)
+		}
+		if pu, ok := p.(plugins.PagerUser); ok {
+			pu.SetPager(d.Pager)
+		}
+	}
+
+	return d, nil
+}
+
+// Init initializes the plugins (see plugins.Initializer). Plugins that fail
+// to initialize are removed, the ones left are handed to the plugins that
+// want them (see plugins.PluginsUser). Init must be called before any
+// messages are dispatched.
+func (d *Dispatcher) Init() {
+	var plugs plugins.Plugins
+	for _, p := range d.Plugins {
+		if i, ok := p.(plugins.Initializer); ok {
+			if err := i.Init(); err != nil {
+				log.Printf("%s: disabled, can't initialize: %s", p.Name(), err)
+				continue
+			}
+		}
+		plugs = append(plugs, p)
+	}
+	d.Plugins = plugs
+
+	for _, p := range d.Plugins {
+		if pu, ok := p.(plugins.PluginsUser); ok {
+			pu.SetPlugins(d.Plugins)
+		}
+	}
+}
+
+// Schedule starts the jobs of the plugins (see plugins.Ticker). Jobs post
+// messages with post.
+func (d *Dispatcher) Schedule(post plugins.Poster) {
+	d.scheduler = plugins.NewScheduler(post)
+	for _, p := range d.Plugins {
+		if t, ok := p.(plugins.Ticker); ok {
+			for _, job := range t.Jobs() {
+				d.scheduler.Add(job)
+			}
+		}
+	}
+}
+
+// Close stops scheduled jobs, drops responses that are waiting to be sent
+// (see plugins.Emitter), waits for the ones being sent and closes the
+// plugins (see plugins.Closer).
+func (d *Dispatcher) Close() {
+	if d.scheduler != nil {
+		d.scheduler.Stop()
+	}
+
+	d.timersMu.Lock()
+	d.closed = true
+	for t := range d.timers {
+		if t.Stop() {
+			d.pending.Done()
+		}
+		delete(d.timers, t)
+	}
+	d.timersMu.Unlock()
+	d.Wait()
+
+	for _, p := range d.Plugins {
+		if c, ok := p.(plugins.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("%s: can't close: %s", p.Name(), err)
+			}
+		}
+	}
+}
+
+// Mode returns the match mode for a given chat.
+func (d *Dispatcher) Mode(chat string) MatchMode {
+	if m, ok := d.Modes[chat]; ok {
+		return m
+	}
+	return AllMatch
+}
+
+// pool returns the work queue of chat, starting its workers if needed.
+func (d *Dispatcher) pool(chat string) chan func() {
+	d.poolsMu.Lock()
+	defer d.poolsMu.Unlock()
+
+	pool, ok := d.pools[chat]
+	if !ok {
+		pool = make(chan func(), d.QueueSize)
+		for range d.Workers {
+			go func() {
+				for job := range pool {
+					job()
+				}
+			}()
+		}
+		d.pools[chat] = pool
+	}
+	return pool
+}
+
+// Dispatch queues msg to be handled by one of the workers of mc.Chat and
+// returns right away, so slow plugins can't hold up a chat. The returned
+// channel is closed once all the immediate responses have been sent.
+// Messages arriving while the queue is full are dropped.
+func (d *Dispatcher) Dispatch(mc *plugins.MessageContext, msg string, reply Replier) <-chan struct{} {
+	done := make(chan struct{})
+
+	d.pending.Add(1)
+	job := func() {
+		defer d.pending.Done()
+		defer close(done)
+		d.dispatch(mc, msg, reply)
+	}
+
+	select {
+	case d.pool(mc.Chat) <- job:
+	default:
+		log.Printf("%s: too busy, dropping message from %q", mc.Chat, mc.Sender)
+		d.pending.Done()
+		close(done)
+	}
+
+	return done
+}
+
+// dispatch runs msg through the plugins. Messages from relay bots are
+// taken to be from who they relay (see plugins.Unrelay). Ignored people
+// (see plugins.Ignored) and messages already seen in a bridged room (see
+// plugins.Bridges) are dropped. The rest is run, without any command
+// prefix or bot name (see plugins.Address), through the plugins that are
+// allowed in mc.Room (see plugins.Allowed) and sends their responses with
+// reply. Plugins needing a higher role than the sender has (see
+// plugins.RoleOf) get a refusal instead. Plugins disabled by the Breaker
+// are skipped. Once someone hits a rate limit (see plugins.RateLimiter)
+// they are asked to slow down, once, and the rest of their messages are
+// ignored until the limit clears. Owners aren't limited. Plugins can keep
+// sending responses after they return (see plugins.Emitter).
+func (d *Dispatcher) dispatch(mc *plugins.MessageContext, msg string, reply Replier) {
+	mode := d.Mode(mc.Chat)
+	msg, ok := plugins.Unrelay(d.Store, mc, msg)
+	if !ok {
+		log.Printf("%s: ignoring relayed message from %q", mc.Chat, mc.Sender)
+		return
+	}
+	mc.User = plugins.Resolve(d.Store, mc)
+	if plugins.Ignored(d.Store, mc) {
+		log.Printf("%s: ignoring %q in %q", mc.Chat, mc.Sender, mc.Room)
+		return
+	}
+	if d.Bridges.Duplicate(d.Store, mc, msg) {
+		log.Printf("%s: already seen %q from %q on a bridged room", mc.Chat, msg, mc.Sender)
+		return
+	}
+	role := plugins.RoleOf(d.Store, mc)
+	if role == plugins.RoleNone {
+		log.Printf("%s: ignoring message from %q", mc.Chat, mc.Sender)
+		return
+	}
+	msg, ok = plugins.Address(d.Store, mc, msg)
+	if !ok {
+		return
+	}
+
+	for _, p := range d.Plugins {
+		if !plugins.Allowed(d.Store, mc, p) {
+			continue
+		}
+		captures, matched := d.match(mc, p, msg)
+		if !matched {
+			continue
+		}
+		if !d.Breaker.Allow(p.Name()) {
+			log.Printf("%s: %s: disabled, ignoring %q", mc.Chat, p.Name(), mc.Sender)
+			continue
+		}
+
+		// Each plugin gets its own copy so Captures can't leak between
+		// plugins or later responses.
+		mc := *mc
+		mc.Captures = captures
+
+		if role < plugins.Required(p) {
+			log.Printf("%s: %s: %q is a %s, needs %s", mc.Chat, p.Name(), mc.Sender, role, plugins.Required(p))
+			d.send(&mc, p, plugins.Errorf("sorry, %s, I can't let you do that.", mc.Name()), reply)
+			if mode == FirstMatch {
+				return
+			}
+			continue
+		}
+
+		if role < plugins.RoleOwner {
+			var limited *plugins.Limited
+			if err := d.Limiter.Take(d.Store, &mc, p); errors.As(err, &limited) {
+				log.Printf("%s: %s: %q: %s", mc.Chat, p.Name(), mc.Sender, err)
+				if limited.Warn {
+					d.send(&mc, p, plugins.Notice(fmt.Sprintf("%s, please slow down a bit.", mc.Name())), reply)
+				}
+				return
+			}
+		}
+
+		log.Printf("%s: %s: responding to %q", mc.Chat, p.Name(), mc.Sender)
+
+		e := &emitter{d: d, mc: &mc, p: p, reply: reply}
+		resp := d.process(e, msg)
+		d.send(&mc, p, resp, reply)
+
+		if mode == FirstMatch && (!resp.Empty() || e.emitted.Load()) {
+			return
+		}
+	}
+}
+
+// match calls p.Match and returns the named groups of p's pattern in msg
+// (see plugins.Captures). A panicking Match, or a pattern that doesn't
+// compile anymore, counts as a failure and doesn't match.
+func (d *Dispatcher) match(mc *plugins.MessageContext, p plugins.Plugin, msg string) (map[string]string, bool) {
+	var captures map[string]string
+	var ok bool
+	err := d.guard(mc, p, func() {
+		if ok = p.Match(mc, msg); ok {
+			captures = plugins.Captures(plugins.Compiled(p), msg)
+		}
+	})
+	if err != nil {
+		return nil, false
+	}
+	return captures, ok
+}
+
+// guard runs f, recovering from panics. Panics are reported and count as
+// a failure of p (see Failed).
+func (d *Dispatcher) guard(mc *plugins.MessageContext, p plugins.Plugin, f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			log.Printf("%s: %s: %s\n%s", mc.Chat, p.Name(), err, debug.Stack())
+			d.report(fmt.Sprintf("%s crashed on %s for %s: %s", p.Name(), mc.Chat, mc.Sender, err))
+			d.Failed(p, err)
+		}
+	}()
+	f()
+	return nil
+}
+
+// Failed records a failure of p with the Breaker, owners are told when p
+// gets disabled.
+func (d *Dispatcher) Failed(p plugins.Plugin, err error) {
+	if d.Breaker.Failure(p.Name(), err) {
+		d.report(fmt.Sprintf("%s failed %d times in a row, disabling it for %s. Last error: %s", p.Name(), d.Breaker.Threshold, d.Breaker.Cooldown, err))
+	}
+}
+
+// report sends msg to the bot owners if there is a way to.
+func (d *Dispatcher) report(msg string) {
+	log.Println(msg)
+	if d.Report != nil {
+		d.Report(msg)
+	}
+}
+
+// emitter is the plugins.Emitter handed to a plugin for a single message.
+type emitter struct {
+	d     *Dispatcher
+	mc    *plugins.MessageContext
+	p     plugins.Plugin
+	reply Replier
+
+	emitted atomic.Bool
+}
+
+func (e *emitter) Emit(resp *plugins.Response) (string, error) {
+	if !resp.Empty() {
+		e.emitted.Store(true)
+	}
+	return e.d.send(e.mc, e.p, resp, e.reply)
+}
+
+func (e *emitter) Edit(id string, resp *plugins.Response) (string, error) {
+	if e.mc.Edits && id != "" && !resp.Empty() {
+		r := *resp
+		r.Edit = id
+		resp = &r
+	}
+	return e.Emit(resp)
+}
+
+func (e *emitter) After(dur time.Duration, resp *plugins.Response) {
+	d := e.d
+	d.timersMu.Lock()
+	defer d.timersMu.Unlock()
+	if d.closed {
+		log.Printf("%s: %s: shutting down, dropping delayed response for %q", e.mc.Chat, e.p.Name(), e.mc.Sender)
+		return
+	}
+	d.pending.Add(1)
+
+	var t *time.Timer
+	t = time.AfterFunc(dur, func() {
+		defer d.pending.Done()
+		d.timersMu.Lock()
+		delete(d.timers, t)
+		d.timersMu.Unlock()
+		e.Emit(resp)
+	})
+	d.timers[t] = true
+}
+
+// process calls the plugin of e with a deadline. If it is slow and hasn't
+// sent anything yet we let the sender know we are still working on it, if
+// it runs out of time or panics they get an error. Both count as a
+// failure of the plugin.
+func (d *Dispatcher) process(e *emitter, msg string) *plugins.Response {
+	mc, p := e.mc, e.p
+	ctx, cancel := context.WithTimeout(context.Background(), plugins.TimeLimit(p, d.Timeout))
+	defer cancel()
+
+	type result struct {
+		resp *plugins.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		r.err = d.guard(mc, p, func() { r.resp = p.Process(ctx, mc, msg, e) })
+		if r.err != nil {
+			r.resp = plugins.Errorf("sorry %s, %s broke.", mc.Name(), p.Name())
+		}
+		done <- r
+	}()
+
+	slow := time.NewTimer(d.SlowAfter)
+	defer slow.Stop()
+
+	for {
+		select {
+		case r := <-done:
+			if r.err == nil {
+				d.Breaker.Success(p.Name())
+			}
+			return r.resp
+		case <-slow.C:
+			if !e.emitted.Load() {
+				d.send(mc, p, plugins.Notice("still working…"), e.reply)
+			}
+		case <-ctx.Done():
+			log.Printf("%s: %s: %s", mc.Chat, p.Name(), ctx.Err())
+			d.Failed(p, ctx.Err())
+			return plugins.Errorf("sorry %s, %s timed out.", mc.Name(), p.Name())
+		}
+	}
+}
+
+// Wait blocks until all queued messages have been handled and all
+// responses waiting to be sent (see plugins.Emitter) have been sent.
+func (d *Dispatcher) Wait() {
+	d.pending.Wait()
+}
+
+// send delivers a single response and returns the ID of the message sent.
+// Transport errors are logged rather than sent back to the user.
+func (d *Dispatcher) send(mc *plugins.MessageContext, p plugins.Plugin, resp *plugins.Response, reply Replier) (string, error) {
+	if resp.Empty() {
+		return "", nil
+	}
+
+	if resp.Kind == plugins.KindError {
+		log.Printf("%s: %s: error for %q: %s", mc.Chat, p.Name(), mc.Sender, resp.Text)
+	}
+
+	id, err := reply(resp)
+	if err != nil {
+		log.Printf("%s: %s: can't send to %q: %s", mc.Chat, p.Name(), mc.Room, err)
+	}
+	return id, err
+}
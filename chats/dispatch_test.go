@@ -0,0 +1,343 @@
+package chats
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+	"suah.dev/mcchunkie/plugins"
+)
+
+type testPlug struct {
+	name     string
+	priority int
+	role     plugins.Role
+}
+
+func (t testPlug) Descr() string                  { return t.name }
+func (t testPlug) Name() string                   { return t.name }
+func (t testPlug) Re() string                     { return "" }
+func (t testPlug) SetStore(_ plugins.PluginStore) {}
+func (t testPlug) Role() plugins.Role {
+	if t.role == plugins.RoleNone {
+		return plugins.RoleUser
+	}
+	return t.role
+}
+func (t testPlug) Priority() int                                  { return t.priority }
+func (t testPlug) Match(_ *plugins.MessageContext, _ string) bool { return true }
+func (t testPlug) Process(_ context.Context, _ *plugins.MessageContext, _ string, _ plugins.Emitter) *plugins.Response {
+	return plugins.Text(t.name)
+}
+
+func TestDispatch(t *testing.T) {
+	plugs := plugins.Plugins{
+		testPlug{name: "low", priority: -1},
+		testPlug{name: "first"},
+		testPlug{name: "high", priority: 10},
+		testPlug{name: "second"},
+	}
+
+	testModes := map[string]string{
+		"IRC":    "[high]",
+		"Matrix": "[high first second low]",
+	}
+
+	d, err := NewDispatcher(mcstoretest.Map{}, plugs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for chat, want := range testModes {
+		var got []string
+		d.Dispatch(&plugins.MessageContext{Chat: chat}, "hi", func(resp *plugins.Response) (string, error) {
+			got = append(got, resp.Text)
+			return "", nil
+		})
+		d.Wait()
+		if fmt.Sprint(got) != want {
+			t.Errorf("%s: expected %s; got %s\n", chat, want, got)
+		}
+	}
+}
+
+func TestDispatchRoles(t *testing.T) {
+	plugs := plugins.Plugins{
+		testPlug{name: "owner", role: plugins.RoleOwner},
+		testPlug{name: "anyone"},
+	}
+
+	testRoles := map[string]string{
+		"@owner:test.com": "[owner anyone]",
+		"@rando:test.com": "[sorry, @rando:test.com, I can't let you do that. anyone]",
+	}
+
+	d, err := NewDispatcher(mcstoretest.Map{"acl_owner": "@owner:test.com"}, plugs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sender, want := range testRoles {
+		var got []string
+		d.Dispatch(&plugins.MessageContext{Chat: "Matrix", Sender: sender}, "hi", func(resp *plugins.Response) (string, error) {
+			got = append(got, resp.Text)
+			return "", nil
+		})
+		d.Wait()
+		if fmt.Sprint(got) != want {
+			t.Errorf("%s: expected %s; got %s\n", sender, want, got)
+		}
+	}
+}
+
+type lifecyclePlug struct {
+	testPlug
+	initErr error
+	events  chan string
+}
+
+func (l *lifecyclePlug) Init() error {
+	l.events <- "init " + l.name
+	return l.initErr
+}
+
+func (l *lifecyclePlug) Close() error {
+	l.events <- "close " + l.name
+	return nil
+}
+
+func (l *lifecyclePlug) Jobs() []plugins.Job {
+	return []plugins.Job{{
+		Name:  l.name,
+		Every: time.Hour,
+		Run: func(post plugins.Poster) error {
+			post("#room", l.name)
+			return nil
+		},
+	}}
+}
+
+func TestDispatchLifecycle(t *testing.T) {
+	events := make(chan string, 10)
+	policy := &plugins.Policy{}
+	plugs := plugins.Plugins{
+		&lifecyclePlug{testPlug: testPlug{name: "good"}, events: events},
+		&lifecyclePlug{testPlug: testPlug{name: "bad"}, events: events, initErr: fmt.Errorf("nope")},
+		policy,
+	}
+
+	d, err := NewDispatcher(mcstoretest.Map{}, plugs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Init()
+	if l := d.Plugins.List(); l != "good, Policy" {
+		t.Errorf("expected only good and Policy to be left; got %q\n", l)
+	}
+	mc := &plugins.MessageContext{Chat: "IRC", Room: "#room"}
+	if resp := policy.Process(context.Background(), mc, "plugins: deny bad", plugins.Discard); resp.Kind != plugins.KindError {
+		t.Errorf("expected Policy to not know about bad; got %q\n", resp.Text)
+	}
+
+	d.Schedule(func(room, message string) {
+		events <- fmt.Sprintf("post %s %s", room, message)
+	})
+	d.Close()
+	close(events)
+
+	e := &emitter{d: d, mc: mc, p: testPlug{name: "late"}}
+	e.After(time.Millisecond, plugins.Text("too late"))
+	if len(d.timers) != 0 {
+		t.Error("expected no responses to be delayed once closed")
+	}
+
+	var got []string
+	for e := range events {
+		got = append(got, e)
+	}
+	want := "[init good init bad post #room good close good]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("expected %s; got %s\n", want, got)
+	}
+}
+
+type slowPlug struct {
+	testPlug
+}
+
+func (s slowPlug) Process(ctx context.Context, _ *plugins.MessageContext, _ string, _ plugins.Emitter) *plugins.Response {
+	<-ctx.Done()
+	return plugins.Text("too late")
+}
+
+func TestDispatchTimeout(t *testing.T) {
+	d, err := NewDispatcher(mcstoretest.Map{}, plugins.Plugins{slowPlug{testPlug{name: "slow"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Timeout = 100 * time.Millisecond
+	d.SlowAfter = 10 * time.Millisecond
+
+	var got []string
+	done := d.Dispatch(&plugins.MessageContext{Chat: "Matrix", Sender: "qbit"}, "hi", func(resp *plugins.Response) (string, error) {
+		got = append(got, fmt.Sprintf("%s: %s", resp.Kind, resp.Text))
+		return "", nil
+	})
+	<-done
+
+	want := "[notice: still working… error: sorry qbit, slow timed out.]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("expected %s; got %s\n", want, got)
+	}
+}
+
+type panicPlug struct {
+	testPlug
+}
+
+func (p panicPlug) Process(_ context.Context, _ *plugins.MessageContext, msg string, _ plugins.Emitter) *plugins.Response {
+	return plugins.Text(strings.Fields(msg)[1])
+}
+
+func TestDispatchPanic(t *testing.T) {
+	status := &plugins.Status{}
+	d, err := NewDispatcher(mcstoretest.Map{"breaker_threshold": "2"}, plugins.Plugins{
+		panicPlug{testPlug{name: "broken"}},
+		status,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []string
+	d.Report = func(msg string) {
+		reports = append(reports, msg)
+	}
+
+	var got []string
+	reply := func(resp *plugins.Response) (string, error) {
+		got = append(got, resp.Text)
+		return "", nil
+	}
+	mc := &plugins.MessageContext{Chat: "IRC", Sender: "qbit"}
+	for _, msg := range []string{"a b", "a", "a", "a"} {
+		<-d.Dispatch(mc, msg, reply)
+	}
+
+	want := "[b sorry qbit, broken broke. sorry qbit, broken broke.]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("expected %s; got %s\n", want, got)
+	}
+	if len(reports) != 3 || !strings.Contains(reports[2], "disabling it for 10m0s") {
+		t.Errorf("expected two crashes and a disabled plugin to be reported; got %q\n", reports)
+	}
+	if d.Breaker.Allow("broken") {
+		t.Error("expected broken to be disabled")
+	}
+	if resp := status.Process(context.Background(), mc, "status:", plugins.Discard); !strings.Contains(resp.Text, "**broken**: disabled until") {
+		t.Errorf("expected status to show broken as disabled; got %q\n", resp.Text)
+	}
+
+	d.Breaker.Cooldown = 0
+	d.Breaker.Failure("broken", fmt.Errorf("boom"))
+	if !d.Breaker.Allow("broken") {
+		t.Error("expected broken to be enabled after the cool-down")
+	}
+	d.Breaker.Success("broken")
+	if len(d.Breaker.State()) != 0 {
+		t.Errorf("expected success to reset the breaker; got %v\n", d.Breaker.State())
+	}
+}
+
+type rePlug struct {
+	testPlug
+	re *string
+}
+
+func (p rePlug) Re() string { return *p.re }
+
+func TestDispatchBadPattern(t *testing.T) {
+	re := "^a$"
+	d, err := NewDispatcher(mcstoretest.Map{"breaker_threshold": "1"}, plugins.Plugins{rePlug{testPlug{name: "changed"}, &re}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Exec plugins read their pattern from the store, it can change
+	// after it was checked.
+	re = "(a"
+	var got []string
+	<-d.Dispatch(&plugins.MessageContext{Chat: "IRC", Sender: "qbit"}, "a", func(resp *plugins.Response) (string, error) {
+		got = append(got, resp.Text)
+		return "", nil
+	})
+	if len(got) != 0 || d.Breaker.Allow("changed") {
+		t.Errorf("expected an invalid pattern to disable the plugin; got %q\n", got)
+	}
+}
+
+type emitPlug struct {
+	testPlug
+}
+
+func (p emitPlug) Process(_ context.Context, _ *plugins.MessageContext, _ string, emit plugins.Emitter) *plugins.Response {
+	id, _ := emit.Emit(plugins.Text("working"))
+	time.Sleep(50 * time.Millisecond)
+	emit.Edit(id, plugins.Text("done"))
+	emit.After(time.Millisecond, plugins.Text("later"))
+	emit.After(time.Hour, plugins.Text("never"))
+	return nil
+}
+
+func TestDispatchEmit(t *testing.T) {
+	d, err := NewDispatcher(mcstoretest.Map{}, plugins.Plugins{
+		emitPlug{testPlug{name: "emit", priority: 1}},
+		testPlug{name: "second"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SlowAfter = 10 * time.Millisecond
+
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	later := make(chan struct{})
+	reply := func(resp *plugins.Response) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, fmt.Sprintf("%s%s: %s", resp.Edit, resp.Kind, resp.Text))
+		if resp.Text == "later" {
+			close(later)
+		}
+		return fmt.Sprintf("#%d ", len(got)), nil
+	}
+
+	<-d.Dispatch(&plugins.MessageContext{Chat: "IRC", Sender: "qbit", Edits: true}, "hi", reply)
+	select {
+	case <-later:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a later response")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close waited for a response that was still waiting to be sent")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := "[text: working #1 text: done text: later]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("expected %s; got %s\n", want, got)
+	}
+}
@@ -0,0 +1,221 @@
+// Package format renders the markdown produced by plugins for chats that
+// display it differently, or not at all.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Format is a kind of message formatting supported by a chat.
+type Format int
+
+const (
+	// Plain is text without any markup, used for SMS, Signal and Mail.
+	Plain Format = iota
+	// Markdown is left as is.
+	Markdown
+	// HTML is used by Matrix.
+	HTML
+	// IRC uses mIRC control codes.
+	IRC
+	// XMPP uses XEP-0393 message styling.
+	XMPP
+)
+
+func (f Format) String() string {
+	switch f {
+	case Plain:
+		return "plain"
+	case Markdown:
+		return "markdown"
+	case HTML:
+		return "html"
+	case IRC:
+		return "irc"
+	case XMPP:
+		return "xmpp"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// marks are what a format puts around styled text.
+type marks struct {
+	bold, italic, strike, code, pre [2]string
+}
+
+var formatMarks = map[Format]marks{
+	Plain: {},
+	IRC: {
+		bold:   [2]string{"\x02", "\x02"},
+		italic: [2]string{"\x1d", "\x1d"},
+		strike: [2]string{"\x1e", "\x1e"},
+		code:   [2]string{"\x11", "\x11"},
+	},
+	XMPP: {
+		bold:   [2]string{"*", "*"},
+		italic: [2]string{"_", "_"},
+		strike: [2]string{"~", "~"},
+		code:   [2]string{"`", "`"},
+		pre:    [2]string{"```\n", "```\n"},
+	},
+}
+
+// Render renders the markdown md in format f.
+func Render(f Format, md string) string {
+	switch f {
+	case Markdown:
+		return md
+	case HTML:
+		return string(markdown.ToHTML([]byte(md), nil, nil))
+	}
+
+	r := &renderer{marks: formatMarks[f]}
+	out := markdown.Render(markdown.Parse([]byte(md), nil), r)
+	return strings.TrimRight(string(out), "\n")
+}
+
+var tagRE = regexp.MustCompile(`<[^>]*>`)
+
+// stripTags removes HTML tags from s, leaving the text.
+func stripTags(s string) string {
+	return html.UnescapeString(tagRE.ReplaceAllString(s, ""))
+}
+
+// renderer is a markdown.Renderer producing text with marks.
+type renderer struct {
+	marks marks
+	// items counts the items of the lists we are in.
+	items []int
+}
+
+func (r *renderer) RenderHeader(io.Writer, ast.Node) {}
+func (r *renderer) RenderFooter(io.Writer, ast.Node) {}
+
+func (r *renderer) mark(w io.Writer, m [2]string, entering bool) {
+	if entering {
+		io.WriteString(w, m[0])
+	} else {
+		io.WriteString(w, m[1])
+	}
+}
+
+// children renders the children of node on their own.
+func (r *renderer) children(node ast.Node) string {
+	var buf bytes.Buffer
+	for _, c := range node.GetChildren() {
+		ast.WalkFunc(c, func(n ast.Node, entering bool) ast.WalkStatus {
+			return r.RenderNode(&buf, n, entering)
+		})
+	}
+	return buf.String()
+}
+
+// link writes text pointing at dest, skipping the text when it is the
+// destination itself.
+func (r *renderer) link(w io.Writer, text, dest string) {
+	switch {
+	case text == "" || text == dest:
+		io.WriteString(w, dest)
+	case dest == "":
+		io.WriteString(w, text)
+	default:
+		fmt.Fprintf(w, "%s (%s)", text, dest)
+	}
+}
+
+func (r *renderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.WalkStatus {
+	switch n := node.(type) {
+	case *ast.Text:
+		w.Write(n.Literal)
+	case *ast.Softbreak, *ast.Hardbreak:
+		io.WriteString(w, "\n")
+	case *ast.Strong:
+		r.mark(w, r.marks.bold, entering)
+	case *ast.Emph:
+		r.mark(w, r.marks.italic, entering)
+	case *ast.Del:
+		r.mark(w, r.marks.strike, entering)
+	case *ast.Code:
+		r.mark(w, r.marks.code, true)
+		w.Write(n.Literal)
+		r.mark(w, r.marks.code, false)
+	case *ast.CodeBlock:
+		r.mark(w, r.marks.pre, true)
+		io.WriteString(w, strings.TrimRight(string(n.Literal), "\n")+"\n")
+		r.mark(w, r.marks.pre, false)
+	case *ast.HTMLBlock:
+		r.mark(w, r.marks.pre, true)
+		io.WriteString(w, strings.TrimRight(stripTags(string(n.Literal)), "\n")+"\n")
+		r.mark(w, r.marks.pre, false)
+	case *ast.HTMLSpan:
+		switch strings.ToLower(string(n.Literal)) {
+		case "<pre>":
+			io.WriteString(w, r.marks.pre[0])
+		case "</pre>":
+			if r.marks.pre[1] != "" {
+				io.WriteString(w, "\n"+strings.TrimSuffix(r.marks.pre[1], "\n"))
+			}
+		default:
+			io.WriteString(w, stripTags(string(n.Literal)))
+		}
+	case *ast.Link:
+		if entering {
+			r.link(w, r.children(n), string(n.Destination))
+		}
+		return ast.SkipChildren
+	case *ast.Image:
+		if entering {
+			r.link(w, r.children(n), string(n.Destination))
+		}
+		return ast.SkipChildren
+	case *ast.Heading:
+		r.mark(w, r.marks.bold, entering)
+		if !entering {
+			io.WriteString(w, "\n")
+		}
+	case *ast.Paragraph:
+		if !entering {
+			io.WriteString(w, "\n")
+		}
+	case *ast.BlockQuote:
+		if entering {
+			io.WriteString(w, "> ")
+		}
+	case *ast.HorizontalRule:
+		io.WriteString(w, "---\n")
+	case *ast.List:
+		if entering {
+			r.items = append(r.items, max(n.Start, 1))
+		} else {
+			r.items = r.items[:len(r.items)-1]
+		}
+	case *ast.ListItem:
+		if entering {
+			depth := len(r.items) - 1
+			io.WriteString(w, strings.Repeat("  ", depth))
+			if n.ListFlags&ast.ListTypeOrdered != 0 {
+				fmt.Fprintf(w, "%d. ", r.items[depth])
+				r.items[depth]++
+			} else {
+				io.WriteString(w, "- ")
+			}
+		}
+	case *ast.TableCell:
+		if entering && ast.GetPrevNode(n) != nil {
+			io.WriteString(w, " | ")
+		}
+	case *ast.TableRow:
+		if !entering {
+			io.WriteString(w, "\n")
+		}
+	}
+	return ast.GoToNext
+}
@@ -0,0 +1,58 @@
+package format
+
+import (
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	testMD := []struct {
+		md               string
+		plain, irc, xmpp string
+	}{
+		{
+			"**Hi**: `(?i)^hi` -  _Friendly bots say hi._",
+			"Hi: (?i)^hi -  Friendly bots say hi.",
+			"\x02Hi\x02: \x11(?i)^hi\x11 -  \x1dFriendly bots say hi.\x1d",
+			"*Hi*: `(?i)^hi` -  _Friendly bots say hi._",
+		},
+		{
+			"[songwhip](https://songwhip.com/a) ~~old~~",
+			"songwhip (https://songwhip.com/a) old",
+			"songwhip (https://songwhip.com/a) \x1eold\x1e",
+			"songwhip (https://songwhip.com/a) ~old~",
+		},
+		{
+			"see https://suah.dev/mcchunkie",
+			"see https://suah.dev/mcchunkie",
+			"see https://suah.dev/mcchunkie",
+			"see https://suah.dev/mcchunkie",
+		},
+		{
+			"# OpenBSD Errata 001 ( _April 5, 2024_ )\n<pre>X &amp; Y\ncrash</pre>\n[patch](https://ftp.openbsd.org/001.patch.sig)",
+			"OpenBSD Errata 001 ( April 5, 2024 )\nX & Y\ncrash\npatch (https://ftp.openbsd.org/001.patch.sig)",
+			"\x02OpenBSD Errata 001 ( \x1dApril 5, 2024\x1d )\x02\nX & Y\ncrash\npatch (https://ftp.openbsd.org/001.patch.sig)",
+			"*OpenBSD Errata 001 ( _April 5, 2024_ )*\n```\nX & Y\ncrash\n```\npatch (https://ftp.openbsd.org/001.patch.sig)",
+		},
+		{
+			"- **one**: 1\n- two\n  1. a\n  2. b",
+			"- one: 1\n- two\n  1. a\n  2. b",
+			"- \x02one\x02: 1\n- two\n  1. a\n  2. b",
+			"- *one*: 1\n- two\n  1. a\n  2. b",
+		},
+	}
+
+	for _, tm := range testMD {
+		for f, want := range map[Format]string{Plain: tm.plain, IRC: tm.irc, XMPP: tm.xmpp} {
+			if got := Render(f, tm.md); got != want {
+				t.Errorf("%s: %q\nexpected %q\n     got %q\n", f, tm.md, want, got)
+			}
+		}
+	}
+
+	if got := Render(Markdown, "**hi**"); got != "**hi**" {
+		t.Errorf("expected markdown to be left alone; got %q\n", got)
+	}
+	if got := Render(HTML, "**hi**"); got != "<p><strong>hi</strong></p>\n" {
+		t.Errorf("expected html; got %q\n", got)
+	}
+}
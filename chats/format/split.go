@@ -0,0 +1,89 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"suah.dev/mcchunkie/plugins"
+)
+
+// Limits describe how much text a chat can take at once.
+type Limits struct {
+	// MaxBytes is the size of the largest message, 0 means no limit.
+	MaxBytes int
+	// Multiline is true for chats whose messages can hold more than one
+	// line. For the others each line is sent as its own message.
+	Multiline bool
+	// MaxLines is the number of lines sent for a single response, the
+	// rest are held back until someone asks for more. 0 means no limit.
+	MaxLines int
+}
+
+// Chunks is text split up to fit a chat.
+type Chunks struct {
+	// Messages are the messages to send. If lines were held back the
+	// last line tells people how to get them (see plugins.MoreLine).
+	Messages []string
+	// Rest are the lines that were held back.
+	Rest []string
+}
+
+// Split splits text into messages that fit l. Lines too long for a single
+// message are cut at word boundaries.
+func Split(text string, l Limits) Chunks {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line == "" && !l.Multiline {
+			continue
+		}
+		lines = append(lines, wrap(line, l.MaxBytes)...)
+	}
+
+	var c Chunks
+	if l.MaxLines > 0 && len(lines) > l.MaxLines {
+		c.Rest = lines[l.MaxLines:]
+		lines = append(lines[:l.MaxLines:l.MaxLines], plugins.MoreLine(len(c.Rest)))
+	}
+
+	if !l.Multiline {
+		c.Messages = lines
+		return c
+	}
+
+	var msg string
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			msg = line
+		case l.MaxBytes == 0 || len(msg)+1+len(line) <= l.MaxBytes:
+			msg += "\n" + line
+		default:
+			c.Messages = append(c.Messages, msg)
+			msg = line
+		}
+	}
+	c.Messages = append(c.Messages, msg)
+	return c
+}
+
+// wrap cuts line into pieces of at most max bytes, preferably at spaces.
+func wrap(line string, max int) []string {
+	var lines []string
+	for max > 0 && len(line) > max {
+		cut := strings.LastIndexByte(line[:max+1], ' ')
+		if cut <= 0 {
+			// No space to cut at, make sure we don't cut a rune in
+			// half.
+			cut = max
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(line)
+			}
+		}
+		lines = append(lines, strings.TrimRight(line[:cut], " "))
+		line = strings.TrimLeft(line[cut:], " ")
+	}
+	return append(lines, line)
+}
@@ -0,0 +1,35 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	testSplits := []struct {
+		text     string
+		limits   Limits
+		messages []string
+		rest     int
+	}{
+		{"one\ntwo", Limits{}, []string{"one", "two"}, 0},
+		{"one\n\ntwo", Limits{Multiline: true}, []string{"one\n\ntwo"}, 0},
+		{"one\n\ntwo", Limits{}, []string{"one", "two"}, 0},
+		{"one two three", Limits{MaxBytes: 8}, []string{"one two", "three"}, 0},
+		{"onetwothree", Limits{MaxBytes: 5}, []string{"onetw", "othre", "e"}, 0},
+		{"ééé", Limits{MaxBytes: 3}, []string{"é", "é", "é"}, 0},
+		{"1\n2\n3\n4\n5", Limits{MaxLines: 2}, []string{"1", "2", "(3 more lines, say `more`)"}, 3},
+		{"1\n2\n3", Limits{MaxLines: 2, Multiline: true}, []string{"1\n2\n(1 more line, say `more`)"}, 1},
+		{"aaa\nbbb\nccc", Limits{MaxBytes: 7, Multiline: true}, []string{"aaa\nbbb", "ccc"}, 0},
+		{long, Limits{MaxBytes: 100, Multiline: true, MaxLines: 1}, []string{strings.TrimSpace(strings.Repeat("word ", 20)), "(1 more line, say `more`)"}, 1},
+	}
+
+	for _, ts := range testSplits {
+		c := Split(ts.text, ts.limits)
+		if fmt.Sprintf("%q", c.Messages) != fmt.Sprintf("%q", ts.messages) || len(c.Rest) != ts.rest {
+			t.Errorf("%q %+v: expected %q (%d more); got %q (%d more)\n", ts.text, ts.limits, ts.messages, ts.rest, c.Messages, len(c.Rest))
+		}
+	}
+}
@@ -93,7 +93,7 @@ func chatReply(msg, gotRoom string, cli Chat) error {
 	}
 	for _, line := range strings.Split(msg, "\n") {
 		log.Printf("GOT: sending '%s'\n", line)
-		err := cli.Send(gotRoom, line)
+		_, err := cli.Send(gotRoom, line)
 		if err != nil {
 			return fmt.Errorf("can not send commit info: %q", err)
 
@@ -119,7 +119,7 @@ func GotListen(store *mcstore.MCStore, cli Chat) {
 			user, pass, ok := r.BasicAuth()
 			err := bcrypt.CompareHashAndPassword([]byte(htpass), []byte(pass))
 			if !(ok && err == nil && user == "got") {
-				log.Printf("GOT: failed auth %q %q %q %q\n", user, pass, err, ok)
+				log.Printf("GOT: failed auth %q %q %q %t\n", user, pass, err, ok)
 				w.Header().Set("WWW-Authenticate", `Basic realm="got notify"`)
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
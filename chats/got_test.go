@@ -9,7 +9,7 @@ import (
 )
 
 func TestGotNotification(t *testing.T) {
-	jsonData, err := os.ReadFile("test_body.json")
+	jsonData, err := os.ReadFile("../test_body.json")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -4,40 +4,160 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
-	"regexp"
-	"strings"
+	"strconv"
+	"sync"
+	"time"
 
 	"gopkg.in/irc.v3"
+	"suah.dev/mcchunkie/chats/format"
 	"suah.dev/mcchunkie/mcstore"
 	"suah.dev/mcchunkie/plugins"
 )
 
 var ircClient *irc.Client
 
+const (
+	// DefaultIRCSendEvery is how often we send a message once the burst
+	// is used up, it can be changed with "irc_send_every".
+	DefaultIRCSendEvery = 2 * time.Second
+	// DefaultIRCSendBurst is how many messages we send right away, it
+	// can be changed with "irc_send_burst".
+	DefaultIRCSendBurst = 4
+	// ircQueueSize is how many messages can wait to be sent.
+	ircQueueSize = 64
+)
+
 type IRCChat struct {
+	// mu guards connected and queue, Send is called from other
+	// goroutines than Connect.
+	mu        sync.Mutex
 	connected bool
+	queue     *ircQueue
+}
+
+// ircQueue paces outgoing messages so we stay under the flood limits of
+// IRC servers. Messages are sent in order, burst of them right away and
+// then one every "every".
+type ircQueue struct {
+	c     *irc.Client
+	msgs  chan *irc.Message
+	every time.Duration
+	burst int
+}
+
+func newIRCQueue(c *irc.Client, every time.Duration, burst int) *ircQueue {
+	return &ircQueue{
+		c:     c,
+		msgs:  make(chan *irc.Message, ircQueueSize),
+		every: every,
+		burst: burst,
+	}
+}
+
+// send queues m, it fails if the queue is full.
+func (q *ircQueue) send(m *irc.Message) error {
+	select {
+	case q.msgs <- m:
+		return nil
+	default:
+		return fmt.Errorf("send queue full")
+	}
+}
+
+// run sends queued messages until stop is closed.
+func (q *ircQueue) run(stop <-chan struct{}) {
+	tokens := q.burst
+	t := time.NewTicker(q.every)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			tokens = min(tokens+1, q.burst)
+		case m := <-q.msgs:
+			if tokens == 0 {
+				select {
+				case <-stop:
+					return
+				case <-t.C:
+					tokens++
+				}
+			}
+			tokens--
+			if err := q.c.WriteMessage(m); err != nil {
+				log.Printf("IRC: can't send %q: %s", m, err)
+			}
+		}
+	}
 }
 
 func (i *IRCChat) Name() string {
 	return "IRC"
 }
 
-func (i *IRCChat) Send(to, message string) error {
-	if !i.connected {
-		return fmt.Errorf("not connected")
+// sendQueue returns the queue of the connection, if we are connected.
+func (i *IRCChat) sendQueue() (*ircQueue, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.connected || i.queue == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return i.queue, nil
+}
+
+func (i *IRCChat) Send(to, message string) (string, error) {
+	q, err := i.sendQueue()
+	if err != nil {
+		return "", err
+	}
+
+	msgs, _ := i.messages(to, plugins.Markdown(message), unpaged(i))
+	for _, m := range msgs {
+		if err := q.send(m); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Format uses mIRC control codes.
+func (i *IRCChat) Format() format.Format {
+	return format.IRC
+}
+
+// Limits keeps messages well under the 512 byte limit of IRC, leaving
+// room for the prefix servers add.
+func (i *IRCChat) Limits() format.Limits {
+	return format.Limits{MaxBytes: 400, MaxLines: 4}
+}
+
+// messages renders a plugin response as IRC messages to "to", one for
+// each line. Lines that didn't fit l are returned as well.
+func (i *IRCChat) messages(to string, resp *plugins.Response, l format.Limits) ([]*irc.Message, []string) {
+	command, text := "PRIVMSG", "%s"
+	switch resp.Kind {
+	case plugins.KindNotice:
+		command = "NOTICE"
+	case plugins.KindEmote:
+		text = "\x01ACTION %s\x01"
+		resp = plugins.Text(resp.Text)
 	}
 
-	return ircClient.WriteMessage(&irc.Message{
-		Command: "PRIVMSG",
-		Params: []string{
-			to,
-			message,
-		},
-	})
+	var msgs []*irc.Message
+	c := format.Split(render(i.Format(), resp), l)
+	for _, line := range c.Messages {
+		msgs = append(msgs, &irc.Message{
+			Command: command,
+			Params:  []string{to, fmt.Sprintf(text, line)},
+		})
+	}
+	return msgs, c.Rest
 }
 
 // IRCConnect connects to our irc server
-func (i *IRCChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) error {
+func (i *IRCChat) Connect(store *mcstore.MCStore, d *Dispatcher) error {
 	ircServer, err := store.Get("irc_server")
 	if err != nil {
 		return err
@@ -54,11 +174,22 @@ func (i *IRCChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) erro
 	if err != nil {
 		log.Println(err)
 	}
-	ircRooms, err := store.Get("irc_rooms")
-	if err != nil {
+	if _, err := store.Get("irc_rooms"); err != nil {
 		return err
 	}
-	fromRe := regexp.MustCompile("^<(.+)> (.+)$")
+	ircRooms := store.List("irc_rooms")
+	sendEvery := DefaultIRCSendEvery
+	if e, err := store.Get("irc_send_every"); err == nil && e != "" {
+		if sendEvery, err = time.ParseDuration(e); err != nil {
+			return fmt.Errorf("irc_send_every: %w", err)
+		}
+	}
+	sendBurst := DefaultIRCSendBurst
+	if b, err := store.Get("irc_send_burst"); err == nil && b != "" {
+		if sendBurst, err = strconv.Atoi(b); err != nil || sendBurst < 1 {
+			return fmt.Errorf("irc_send_burst: invalid number of messages: %q", b)
+		}
+	}
 	if ircServer != "" {
 		log.Printf("IRC: connecting to %q\n", ircServer)
 
@@ -78,8 +209,10 @@ func (i *IRCChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) erro
 			Handler: irc.HandlerFunc(func(c *irc.Client, m *irc.Message) {
 				switch m.Command {
 				case "001":
+					i.mu.Lock()
 					i.connected = true
-					for _, r := range strings.Split(ircRooms, ",") {
+					i.mu.Unlock()
+					for _, r := range ircRooms {
 						log.Printf("IRC: joining %q\n", r)
 						c.Write(fmt.Sprintf("JOIN %s", r))
 					}
@@ -91,62 +224,50 @@ func (i *IRCChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) erro
 					room := m.Trailing()
 					log.Printf("IRC: joining %q\n", room)
 					c.Write(fmt.Sprintf("JOIN %s", room))
+				case "NOTICE":
+					// Bots talk in notices and must not be answered,
+					// doing so can make them talk back forever.
 				case "PRIVMSG":
 					msg := m.Trailing()
 					from := m.Prefix.Name
 					to := m.Params[0]
 
-					if from == "tapebot" {
-						msg = strings.TrimPrefix(msg, "tapebot ")
-						from = fromRe.ReplaceAllString(msg, "${1}")
-						msg = fromRe.ReplaceAllString(msg, "${2}")
-					}
-
 					if from == c.CurrentNick() {
 						// Ignore messages from ourselves
 						return
 					}
 
-					resp := ""
-					delayedResp := func() string { return "" }
-					for _, p := range *plugins {
-						if p.Match(c.CurrentNick(), msg) {
-							p.SetStore(store)
-
-							resp, delayedResp = p.Process(from, msg)
-						}
-					}
-
 					if !c.FromChannel(m) {
 						// in a private chat
 						to = from
 
 					}
 
-					if resp != "" {
+					msgCtx := &plugins.MessageContext{
+						Chat:        i.Name(),
+						Room:        to,
+						Sender:      from,
+						DisplayName: from,
+						Direct:      !c.FromChannel(m),
+						BotName:     c.CurrentNick(),
+						BotNick:     c.CurrentNick(),
+					}
+
+					d.Dispatch(msgCtx, msg, func(resp *plugins.Response) (string, error) {
 						log.Printf("IRC: sending: %q to %q\n", resp, to)
-						c.WriteMessage(&irc.Message{
-							Command: "PRIVMSG",
-							Params: []string{
-								to,
-								resp,
-							},
-						})
-						go func() {
-							dresp := delayedResp()
-
-							if resp != "" {
-								log.Printf("IRC: sending: %q to %q\n", dresp, to)
-								c.WriteMessage(&irc.Message{
-									Command: "PRIVMSG",
-									Params: []string{
-										to,
-										dresp,
-									},
-								})
+						q, err := i.sendQueue()
+						if err != nil {
+							return "", err
+						}
+						msgs, rest := i.messages(to, resp, i.Limits())
+						d.Pager.Hold(msgCtx, plugins.KindText, rest)
+						for _, m := range msgs {
+							if err := q.send(m); err != nil {
+								return "", err
 							}
-						}()
-					}
+						}
+						return "", nil
+					})
 				default:
 					log.Printf("IRC: unhandled - %q", m.String())
 				}
@@ -154,9 +275,20 @@ func (i *IRCChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) erro
 		}
 
 		ircClient = irc.NewClient(conn, config)
+		q := newIRCQueue(ircClient, sendEvery, sendBurst)
+		i.mu.Lock()
+		i.queue = q
+		i.mu.Unlock()
+
+		stop := make(chan struct{})
+		go q.run(stop)
 		err = ircClient.Run()
+		close(stop)
+
+		i.mu.Lock()
+		i.connected, i.queue = false, nil
+		i.mu.Unlock()
 		if err != nil {
-			i.connected = false
 			return err
 		}
 	}
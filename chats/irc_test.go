@@ -0,0 +1,28 @@
+package chats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestIRCSendAll(t *testing.T) {
+	i := &IRCChat{connected: true, queue: newIRCQueue(nil, DefaultIRCSendEvery, DefaultIRCSendBurst)}
+
+	var lines []string
+	for n := range i.Limits().MaxLines + 2 {
+		lines = append(lines, fmt.Sprintf("line %d", n))
+	}
+	if _, err := i.Send("#test", strings.Join(lines, "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []string
+	for len(i.queue.msgs) > 0 {
+		m := <-i.queue.msgs
+		sent = append(sent, m.Params[1])
+	}
+	if strings.Join(sent, "\n") != strings.Join(lines, "\n") {
+		t.Errorf("expected every line to be sent; got %q\n", sent)
+	}
+}
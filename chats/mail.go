@@ -13,6 +13,7 @@ import (
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
 	"github.com/emersion/go-message/mail"
+	"suah.dev/mcchunkie/chats/format"
 	"suah.dev/mcchunkie/mcstore"
 	"suah.dev/mcchunkie/plugins"
 )
@@ -23,8 +24,18 @@ func (m *MailChat) Name() string {
 	return "Mail"
 }
 
-func (m *MailChat) Send(string, string) error {
-	return nil
+func (m *MailChat) Send(string, string) (string, error) {
+	return "", nil
+}
+
+// Format is plain text.
+func (m *MailChat) Format() format.Format {
+	return format.Plain
+}
+
+// Limits doesn't limit, mail can be as long as it likes.
+func (m *MailChat) Limits() format.Limits {
+	return format.Limits{Multiline: true}
 }
 
 type mmail struct {
@@ -36,7 +47,7 @@ type mmail struct {
 	updateChan chan client.Update
 }
 
-func (m *mmail) buildFancyReply(msgID, to, from, originalSubject, resp string) error {
+func (m *mmail) buildFancyReply(msgID, to, from, originalSubject string, resp *plugins.Response) error {
 	buf := new(bytes.Buffer)
 	w, err := mail.CreateWriter(buf, mail.HeaderFromMap(map[string][]string{
 		"From":        {to},
@@ -56,7 +67,7 @@ func (m *mmail) buildFancyReply(msgID, to, from, originalSubject, resp string) e
 		return err
 	}
 
-	_, err = textPart.Write([]byte(resp + "\r\n"))
+	_, err = textPart.Write([]byte(render(format.Plain, resp) + "\r\n"))
 	if err != nil {
 		return err
 	}
@@ -65,6 +76,26 @@ func (m *mmail) buildFancyReply(msgID, to, from, originalSubject, resp string) e
 		return err
 	}
 
+	if resp.Kind == plugins.KindImage {
+		attHeader := mail.AttachmentHeader{}
+		attHeader.Set("Content-Type", "image/png")
+		attHeader.SetFilename("image.png")
+
+		attPart, err := w.CreateAttachment(attHeader)
+		if err != nil {
+			return err
+		}
+
+		_, err = attPart.Write(resp.Image)
+		if err != nil {
+			return err
+		}
+
+		if err := attPart.Close(); err != nil {
+			return err
+		}
+	}
+
 	if err := w.Close(); err != nil {
 		return err
 	}
@@ -126,17 +157,48 @@ func (m *mmail) buildReply(msgID, subj, to, from, resp string) error {
 	reSubj := fmt.Sprintf("Re: %s", subj)
 
 	wc := new(bytes.Buffer)
-	fmt.Fprintf(wc, fmt.Sprintf("To: %s\r\n", from))
-	fmt.Fprintf(wc, fmt.Sprintf("From: %s\r\n", to))
-	fmt.Fprintf(wc, fmt.Sprintf("Subject: %s\r\n", reSubj))
-	fmt.Fprintf(wc, fmt.Sprintf("References: %s\r\n", msgID))
-	fmt.Fprintf(wc, fmt.Sprintf("In-Reply-To: %s\r\n", msgID))
-	fmt.Fprintf(wc, "\r\n"+resp+"\r\n")
+	fmt.Fprintf(wc, "To: %s\r\n", from)
+	fmt.Fprintf(wc, "From: %s\r\n", to)
+	fmt.Fprintf(wc, "Subject: %s\r\n", reSubj)
+	fmt.Fprintf(wc, "References: %s\r\n", msgID)
+	fmt.Fprintf(wc, "In-Reply-To: %s\r\n", msgID)
+	fmt.Fprintf(wc, "\r\n%s\r\n", resp)
 
 	return m.send(to, from, wc.Bytes())
 }
 
-func (mc *MailChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) error {
+// mailVerified reports whether our own mail server checked that the mail
+// is from address: one of results (Authentication-Results headers) added
+// by authserv ("mail_authserv", the authserv-id of the server) shows a
+// DMARC pass for the domain of address. The server has to remove headers
+// claiming to be from authserv from incoming mail, as RFC 8601 asks.
+// Without authserv nobody is verified, anyone can write any From.
+func mailVerified(results []string, authserv, address string) bool {
+	_, domain, ok := strings.Cut(address, "@")
+	if authserv == "" || !ok {
+		return false
+	}
+	for _, r := range results {
+		id, rest, _ := strings.Cut(r, ";")
+		if f := strings.Fields(id); len(f) == 0 || !strings.EqualFold(f[0], authserv) {
+			continue
+		}
+		for _, res := range strings.Split(rest, ";") {
+			f := strings.Fields(res)
+			if len(f) == 0 || !strings.EqualFold(f[0], "dmarc=pass") {
+				continue
+			}
+			for _, prop := range f[1:] {
+				if v, ok := strings.CutPrefix(strings.ToLower(prop), "header.from="); ok && v == strings.ToLower(domain) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (mc *MailChat) Connect(store *mcstore.MCStore, d *Dispatcher) error {
 	smtpUser, err := store.Get("smtp_user")
 	if err != nil {
 		return err
@@ -157,6 +219,7 @@ func (mc *MailChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) er
 	if err != nil {
 		return err
 	}
+	authserv, _ := store.Get("mail_authserv")
 
 	m := mmail{
 		smtpUser:   smtpUser,
@@ -266,39 +329,26 @@ func (mc *MailChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) er
 					}
 
 					if to != "" && from != "" && msg != "" && subj != "" {
-						for _, p := range *plugins {
-							if p.Match(from, msg) {
-								log.Printf("%s: responding to '%s'", p.Name(), from)
-								p.SetStore(store)
-
-								resp, delayedResp := p.Process(from, msg)
-
-								/*
-									err := m.buildReply(msgID, subj, to, from, resp)
-									if err != nil {
-										log.Println(err)
-										continue
-									}
-								*/
-
-								if resp != "" {
-									err := m.buildFancyReply(msgID, to, from, subj, resp)
-									if err != nil {
-										log.Println(err)
-										continue
-									}
-									go func() {
-										dresp := delayedResp()
-										if dresp != "" {
-											err := m.buildFancyReply(msgID, to, from, subj, dresp)
-											if err != nil {
-												log.Println(err)
-											}
-										}
-									}()
-								}
+						msgCtx := &plugins.MessageContext{
+							Chat:        mc.Name(),
+							Room:        from,
+							Sender:      from,
+							DisplayName: from,
+							Direct:      true,
+							BotName:     to,
+							MessageID:   msgID,
+						}
+						if addr, err := mail.ParseAddress(from); err == nil {
+							msgCtx.Sender = addr.Address
+							if addr.Name != "" {
+								msgCtx.DisplayName = addr.Name
 							}
 						}
+						msgCtx.Unverified = !mailVerified(mr.Header.Values("Authentication-Results"), authserv, msgCtx.Sender)
+
+						d.Dispatch(msgCtx, msg, func(resp *plugins.Response) (string, error) {
+							return "", m.buildFancyReply(msgID, to, from, subj, resp)
+						})
 					}
 				}
 
@@ -0,0 +1,26 @@
+package chats
+
+import "testing"
+
+func TestMailVerified(t *testing.T) {
+	testResults := []struct {
+		results  []string
+		authserv string
+		from     string
+		want     bool
+	}{
+		{[]string{"mx.tapenet.org; dkim=pass header.d=tapenet.org; dmarc=pass (p=reject) header.from=tapenet.org"}, "mx.tapenet.org", "qbit@tapenet.org", true},
+		{[]string{"mx.tapenet.org 1; dmarc=pass header.from=Tapenet.org"}, "mx.tapenet.org", "qbit@tapenet.org", true},
+		{[]string{"mx.tapenet.org; dmarc=pass header.from=tapenet.org"}, "", "qbit@tapenet.org", false},
+		{[]string{"mx.evil.com; dmarc=pass header.from=tapenet.org"}, "mx.tapenet.org", "qbit@tapenet.org", false},
+		{[]string{"mx.tapenet.org; dmarc=fail header.from=tapenet.org"}, "mx.tapenet.org", "qbit@tapenet.org", false},
+		{[]string{"mx.tapenet.org; dmarc=pass header.from=evil.com"}, "mx.tapenet.org", "qbit@tapenet.org", false},
+		{nil, "mx.tapenet.org", "qbit@tapenet.org", false},
+	}
+
+	for _, tr := range testResults {
+		if got := mailVerified(tr.results, tr.authserv, tr.from); got != tr.want {
+			t.Errorf("%q from %q: expected %t; got %t\n", tr.results, tr.authserv, tr.want, got)
+		}
+	}
+}
@@ -1,26 +1,123 @@
 package chats
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/matrix-org/gomatrix"
+	"suah.dev/mcchunkie/chats/format"
 	"suah.dev/mcchunkie/mcstore"
 	"suah.dev/mcchunkie/plugins"
 )
 
 type MatrixChat struct {
-	client *gomatrix.Client
+	client  *gomatrix.Client
+	members map[string]*gomatrix.RespJoinedMembers
 }
 
 func (mc *MatrixChat) Name() string { return "Matrix" }
 
-func (mc *MatrixChat) Send(to, msg string) error {
-	return plugins.SendMDNotice(mc.client, to, msg)
+// Send sends msg to the room to. Matrix messages go to rooms, people can't
+// be sent to directly.
+func (mc *MatrixChat) Send(to, msg string) (string, error) {
+	if strings.HasPrefix(to, "@") {
+		return "", fmt.Errorf("%q is a user, not a room", to)
+	}
+	return sendMessage(mc.client, to, message(plugins.KindNotice, msg))
+}
+
+// Format is HTML.
+func (mc *MatrixChat) Format() format.Format {
+	return format.HTML
+}
+
+// Limits keeps events well under the 64KiB Matrix allows.
+func (mc *MatrixChat) Limits() format.Limits {
+	return format.Limits{MaxBytes: 16 * 1024, Multiline: true, MaxLines: 50}
+}
+
+// joined returns the (cached) members of a room.
+func (mc *MatrixChat) joined(roomID string) *gomatrix.RespJoinedMembers {
+	if m, ok := mc.members[roomID]; ok {
+		return m
+	}
+	m, err := mc.client.JoinedMembers(roomID)
+	if err != nil {
+		log.Printf("Matrix: can't get members of %q: %s", roomID, err)
+		return nil
+	}
+	mc.members[roomID] = m
+	return m
 }
 
-func (mc *MatrixChat) Connect(store *mcstore.MCStore, plugs *plugins.Plugins) error {
+// messageContext describes ev for plugins.
+func (mc *MatrixChat) messageContext(ev *gomatrix.Event, botName string) *plugins.MessageContext {
+	msgCtx := &plugins.MessageContext{
+		Chat:        mc.Name(),
+		Room:        ev.RoomID,
+		Sender:      ev.Sender,
+		DisplayName: plugins.NameRE.ReplaceAllString(ev.Sender, "$1"),
+		BotName:     botName,
+		MessageID:   ev.ID,
+		Edits:       true,
+	}
+
+	if members := mc.joined(ev.RoomID); members != nil {
+		msgCtx.Direct = len(members.Joined) <= 2
+		if m, ok := members.Joined[ev.Sender]; ok && m.DisplayName != nil && *m.DisplayName != "" {
+			msgCtx.DisplayName = *m.DisplayName
+		}
+	}
+
+	return msgCtx
+}
+
+// respond renders a plugin response into the room ev came from and returns
+// the event ID of the (first) message sent. Long responses are split before
+// they are rendered, so HTML isn't cut in the middle of a tag. Lines that
+// didn't fit are returned. Edits only replace the first message, the rest
+// of an edited response is held back.
+func (mc *MatrixChat) respond(ev *gomatrix.Event, resp *plugins.Response) (string, []string, error) {
+	if resp.Empty() {
+		return "", nil, nil
+	}
+
+	switch resp.Kind {
+	case plugins.KindImage:
+		id, err := sendImage(mc.client, ev.RoomID, resp.Image)
+		return id, nil, err
+	case plugins.KindReaction:
+		id, err := sendReaction(mc.client, ev.RoomID, ev.ID, resp.Text)
+		return id, nil, err
+	}
+
+	c := format.Split(resp.Text, mc.Limits())
+	if resp.Edit != "" {
+		var rest []string
+		for _, msg := range c.Messages[1:] {
+			rest = append(rest, strings.Split(msg, "\n")...)
+		}
+		id, err := editMessage(mc.client, ev.RoomID, resp.Edit, message(resp.Kind, c.Messages[0]))
+		return id, append(rest, c.Rest...), err
+	}
+
+	var first string
+	for _, msg := range c.Messages {
+		id, err := sendMessage(mc.client, ev.RoomID, message(resp.Kind, msg))
+		if err != nil {
+			return first, nil, err
+		}
+		if first == "" {
+			first = id
+		}
+	}
+	return first, c.Rest, nil
+}
+
+func (mc *MatrixChat) Connect(store *mcstore.MCStore, d *Dispatcher) error {
 	server, err := store.Get("matrix_server")
 	if err != nil {
 		return err
@@ -48,11 +145,7 @@ func (mc *MatrixChat) Connect(store *mcstore.MCStore, plugs *plugins.Plugins) er
 	if err != nil {
 		return err
 	}
-	botOwner, err := store.Get("matrix_bot_owner")
-	if err != nil {
-		return err
-	}
-
+	mc.members = make(map[string]*gomatrix.RespJoinedMembers)
 	mc.client.SetCredentials(userID, accessToken)
 	mc.client.Store = store
 	syncer := gomatrix.NewDefaultSyncer(username, store)
@@ -60,18 +153,21 @@ func (mc *MatrixChat) Connect(store *mcstore.MCStore, plugs *plugins.Plugins) er
 	mc.client.Syncer = syncer
 
 	syncer.OnEventType("m.room.member", func(ev *gomatrix.Event) {
+		delete(mc.members, ev.RoomID)
 		if ev.Sender == username {
 			return
 		}
-		switch ev.Sender {
-		case botOwner:
-			if ev.Content["membership"] == "invite" {
-				log.Printf("Joining %s (invite from %s)\n", ev.RoomID, ev.Sender)
-				if _, err := mc.client.JoinRoom(ev.RoomID, "", nil); err != nil {
-					log.Fatalln(err)
-				}
-				return
-			}
+		if ev.Content["membership"] != "invite" {
+			return
+		}
+		from := &plugins.MessageContext{Chat: mc.Name(), Sender: ev.Sender}
+		if plugins.RoleOf(store, from) < plugins.RoleOwner {
+			log.Printf("Ignoring invite to %s from %s\n", ev.RoomID, ev.Sender)
+			return
+		}
+		log.Printf("Joining %s (invite from %s)\n", ev.RoomID, ev.Sender)
+		if _, err := mc.client.JoinRoom(ev.RoomID, "", nil); err != nil {
+			log.Printf("Can't join %s: %s\n", ev.RoomID, err)
 		}
 	})
 
@@ -80,29 +176,127 @@ func (mc *MatrixChat) Connect(store *mcstore.MCStore, plugs *plugins.Plugins) er
 			return
 		}
 
-		for _, p := range *plugs {
-			var post string
-			var ok bool
-			if post, ok = ev.Body(); !ok {
-				return
-			}
-			if mtype, ok := ev.MessageType(); ok {
-				switch mtype {
-				case "m.text":
-					if p.Match(username, post) {
-						log.Printf("%s: responding to '%s'", p.Name(), ev.Sender)
-						p.SetStore(store)
-
-						err := p.RespondText(mc.client, ev, username, post)
-						if err != nil {
-							fmt.Println(err)
-							plugins.SendText(mc.client, ev.RoomID, err.Error())
-						}
-					}
-				}
+		post, ok := ev.Body()
+		if !ok {
+			return
+		}
+		if mtype, ok := ev.MessageType(); ok {
+			switch mtype {
+			case "m.notice":
+				// Bots talk in notices and must not be answered,
+				// doing so can make them talk back forever.
+			case "m.text":
+				msgCtx := mc.messageContext(ev, username)
+				d.Dispatch(msgCtx, post, func(resp *plugins.Response) (string, error) {
+					id, rest, err := mc.respond(ev, resp)
+					d.Pager.Hold(msgCtx, resp.Kind, rest)
+					return id, err
+				})
 			}
 		}
 	})
 
 	return mc.client.Sync()
 }
+
+// message builds the content of an m.room.message event for text of the
+// given kind. Markdown is converted to HTML.
+func message(kind plugins.Kind, text string) map[string]any {
+	var msg gomatrix.HTMLMessage
+	switch kind {
+	case plugins.KindMarkdown:
+		msg = gomatrix.GetHTMLMessage("m.text", format.Render(format.HTML, text))
+	case plugins.KindNotice:
+		msg = gomatrix.GetHTMLMessage("m.notice", format.Render(format.HTML, text))
+	case plugins.KindEmote:
+		msg = gomatrix.GetHTMLMessage("m.emote", text)
+	default:
+		msg = gomatrix.HTMLMessage{MsgType: "m.text", Body: text}
+	}
+
+	// Plain text is sent without format and formatted_body, some clients
+	// show an empty message when they are there but empty.
+	content := map[string]any{
+		"msgtype": msg.MsgType,
+		"body":    msg.Body,
+	}
+	if msg.Format != "" {
+		content["format"] = msg.Format
+		content["formatted_body"] = msg.FormattedBody
+	}
+	return content
+}
+
+// sendMessage sends a message to a given room and returns its event ID. It
+// pretends to be "typing" by calling UserTyping for the caller.
+func sendMessage(c *gomatrix.Client, roomID string, content any) (string, error) {
+	_, err := c.UserTyping(roomID, true, 3)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.SendMessageEvent(roomID, "m.room.message", content)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = c.UserTyping(roomID, false, 0)
+	if err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+// editMessage replaces the message eventID with msg. Clients that don't
+// know about edits show the new text as a message starting with "*".
+func editMessage(c *gomatrix.Client, roomID, eventID string, msg map[string]any) (string, error) {
+	content := map[string]any{
+		"msgtype":       msg["msgtype"],
+		"body":          fmt.Sprintf("* %s", msg["body"]),
+		"m.new_content": msg,
+		"m.relates_to": map[string]string{
+			"rel_type": "m.replace",
+			"event_id": eventID,
+		},
+	}
+	if f, ok := msg["format"]; ok {
+		content["format"] = f
+		content["formatted_body"] = fmt.Sprintf("* %s", msg["formatted_body"])
+	}
+
+	_, err := c.SendMessageEvent(roomID, "m.room.message", content)
+	if err != nil {
+		return "", err
+	}
+	return eventID, nil
+}
+
+// sendImage takes PNG data and sends it!.
+func sendImage(c *gomatrix.Client, roomID string, img []byte) (string, error) {
+	mediaURL, err := c.UploadToContentRepo(bytes.NewReader(img), "image/png", int64(len(img)))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.SendImage(roomID, "embedded_image.png", mediaURL.ContentURI)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.EventID, nil
+}
+
+// sendReaction reacts to eventID with key.
+func sendReaction(c *gomatrix.Client, roomID, eventID, key string) (string, error) {
+	resp, err := c.SendMessageEvent(roomID, "m.reaction", map[string]any{
+		"m.relates_to": map[string]string{
+			"rel_type": "m.annotation",
+			"event_id": eventID,
+			"key":      key,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
@@ -0,0 +1,19 @@
+package chats
+
+import (
+	"testing"
+
+	"suah.dev/mcchunkie/plugins"
+)
+
+func TestMessage(t *testing.T) {
+	text := message(plugins.KindText, "hi <b>")
+	if len(text) != 2 || text["msgtype"] != "m.text" || text["body"] != "hi <b>" {
+		t.Errorf("expected plain text to only have msgtype and body; got %v\n", text)
+	}
+
+	md := message(plugins.KindMarkdown, "**hi**")
+	if md["format"] != "org.matrix.custom.html" || md["formatted_body"] != "<p><strong>hi</strong></p>\n" {
+		t.Errorf("expected markdown to be sent as HTML; got %v\n", md)
+	}
+}
@@ -2,6 +2,7 @@ package chats
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,7 +10,9 @@ import (
 	"math/rand"
 	"net"
 	"regexp"
+	"strconv"
 
+	"suah.dev/mcchunkie/chats/format"
 	"suah.dev/mcchunkie/mcstore"
 	"suah.dev/mcchunkie/plugins"
 )
@@ -29,18 +32,29 @@ type Mention struct {
 }
 
 type DataMessage struct {
-	Recipient []string  `json:"recipient,omitempty"`
-	ID        string    `json:"id"`
-	GroupID   string    `json:"groupId,omitempty"`
-	Timestamp int64     `json:"timestamp"`
-	Message   string    `json:"message"`
-	GroupInfo GroupInfo `json:"groupInfo"`
-	Mentions  []Mention `json:"mentions,omitempty"`
+	Recipient   []string  `json:"recipient,omitempty"`
+	ID          string    `json:"id"`
+	GroupID     string    `json:"groupId,omitempty"`
+	Timestamp   int64     `json:"timestamp"`
+	Message     string    `json:"message"`
+	GroupInfo   GroupInfo `json:"groupInfo"`
+	Mentions    []Mention `json:"mentions,omitempty"`
+	Attachments []string  `json:"attachments,omitempty"`
+}
+
+type ReactionMessage struct {
+	Recipient       []string `json:"recipient,omitempty"`
+	ID              string   `json:"id"`
+	GroupID         string   `json:"groupId,omitempty"`
+	Emoji           string   `json:"emoji"`
+	TargetAuthor    string   `json:"targetAuthor"`
+	TargetTimestamp int64    `json:"targetTimestamp"`
 }
 
 type Envelope struct {
 	SourceNumber string      `json:"sourceNumber"`
 	SourceUUID   string      `json:"sourceUuid"`
+	SourceName   string      `json:"sourceName"`
 	DataMessage  DataMessage `json:"dataMessage"`
 }
 
@@ -61,6 +75,12 @@ type SendEvent struct {
 	Params  DataMessage `json:"params"`
 }
 
+type ReactionEvent struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  ReactionMessage `json:"params"`
+}
+
 type ReceiveEvent struct {
 	JSONRPC string `json:"jsonrpc"`
 	Method  string `json:"method"`
@@ -84,19 +104,17 @@ func NewSendEvent() *SendEvent {
 	return se
 }
 
-func (x *SignalChat) Send(to string, resp string) error {
-	se := NewSendEvent()
-	se.Params.Message = resp
-	se.Params.ID = randID()
-
+// signalTarget splits "to" into a recipient or a group ID.
+func signalTarget(to string) ([]string, string) {
 	uuidRE := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
 	if uuidRE.Match([]byte(to)) {
-		se.Params.Recipient = append(se.Params.Recipient, to)
-	} else {
-		se.Params.GroupID = to
+		return []string{to}, ""
 	}
+	return nil, to
+}
 
-	data, err := json.Marshal(se)
+func (x *SignalChat) write(ev any) error {
+	data, err := json.Marshal(ev)
 	if err != nil {
 		return err
 	}
@@ -106,11 +124,86 @@ func (x *SignalChat) Send(to string, resp string) error {
 	return nil
 }
 
+func (x *SignalChat) Send(to string, message string) (string, error) {
+	text := render(x.Format(), plugins.Markdown(message))
+	return "", x.sendAll(to, format.Split(text, unpaged(x)))
+}
+
+// sendAll sends each of the chunks.
+func (x *SignalChat) sendAll(to string, c format.Chunks) error {
+	for _, msg := range c.Messages {
+		if err := x.send(to, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Format is plain text.
+func (x *SignalChat) Format() format.Format {
+	return format.Plain
+}
+
+// Limits splits messages before Signal turns them into attachments.
+func (x *SignalChat) Limits() format.Limits {
+	return format.Limits{MaxBytes: 2000, Multiline: true, MaxLines: 30}
+}
+
+// send sends text as is.
+func (x *SignalChat) send(to string, text string) error {
+	se := NewSendEvent()
+	se.Params.Message = text
+	se.Params.ID = randID()
+	se.Params.Recipient, se.Params.GroupID = signalTarget(to)
+
+	return x.write(se)
+}
+
+func (x *SignalChat) sendImage(to, alt string, img []byte) error {
+	se := NewSendEvent()
+	se.Params.Message = alt
+	se.Params.ID = randID()
+	se.Params.Recipient, se.Params.GroupID = signalTarget(to)
+	se.Params.Attachments = []string{
+		fmt.Sprintf("data:image/png;filename=image.png;base64,%s",
+			base64.StdEncoding.EncodeToString(img)),
+	}
+
+	return x.write(se)
+}
+
+func (x *SignalChat) sendReaction(to, emoji string, env Envelope) error {
+	re := &ReactionEvent{
+		JSONRPC: "2.0",
+		Method:  "sendReaction",
+	}
+	re.Params.ID = randID()
+	re.Params.Recipient, re.Params.GroupID = signalTarget(to)
+	re.Params.Emoji = emoji
+	re.Params.TargetAuthor = env.SourceUUID
+	re.Params.TargetTimestamp = env.DataMessage.Timestamp
+
+	return x.write(re)
+}
+
+// respond renders a plugin response as a reply to env. Lines that didn't
+// fit are returned.
+func (x *SignalChat) respond(env Envelope, to string, resp *plugins.Response) ([]string, error) {
+	switch resp.Kind {
+	case plugins.KindImage:
+		return nil, x.sendImage(to, resp.Text, resp.Image)
+	case plugins.KindReaction:
+		return nil, x.sendReaction(to, resp.Text, env)
+	}
+	c := split(x, resp)
+	return c.Rest, x.sendAll(to, c)
+}
+
 func (x *SignalChat) Name() string {
 	return "Signal"
 }
 
-func (x *SignalChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) error {
+func (x *SignalChat) Connect(store *mcstore.MCStore, d *Dispatcher) error {
 	number, _ := store.Get("signal_number")
 	socket, _ := store.Get("signal_socket")
 	if x.number == "" {
@@ -190,27 +283,23 @@ func (x *SignalChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) e
 						from = event.Params.Envelope.DataMessage.GroupInfo.GroupID
 					}
 
-					resp := ""
-					delayedResp := func() string { return "" }
-
-					for _, p := range *plugins {
-
-						if p.Match(from, msg) {
-							p.SetStore(store)
-							resp, delayedResp = p.Process(from, msg)
-						}
+					msgCtx := &plugins.MessageContext{
+						Chat:        x.Name(),
+						Room:        from,
+						Sender:      event.Params.Envelope.SourceUUID,
+						DisplayName: event.Params.Envelope.SourceName,
+						Direct:      event.Params.Envelope.DataMessage.GroupInfo.GroupID == "",
+						BotName:     x.number,
+						MessageID:   strconv.FormatInt(event.Params.Envelope.DataMessage.Timestamp, 10),
 					}
-					if resp != "" {
+
+					env := event.Params.Envelope
+					d.Dispatch(msgCtx, msg, func(resp *plugins.Response) (string, error) {
 						log.Printf("Signal: sending: %q to %q\n", resp, from)
-						x.Send(from, resp)
-						go func() {
-							dresp := delayedResp()
-							if dresp != "" {
-								log.Printf("Signal: sending: %q to %q\n", dresp, from)
-								x.Send(from, dresp)
-							}
-						}()
-					}
+						rest, err := x.respond(env, from, resp)
+						d.Pager.Hold(msgCtx, plugins.KindText, rest)
+						return "", err
+					})
 				}
 			}
 		}
@@ -0,0 +1,32 @@
+package chats
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSignalSendAll(t *testing.T) {
+	x := &SignalChat{in: make(chan []byte, 10)}
+
+	var lines []string
+	for n := range x.Limits().MaxLines + 2 {
+		lines = append(lines, fmt.Sprintf("line %d", n))
+	}
+	if _, err := x.Send("group", strings.Join(lines, "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []string
+	for len(x.in) > 0 {
+		var se SendEvent
+		if err := json.Unmarshal(<-x.in, &se); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, se.Params.Message)
+	}
+	if strings.Join(sent, "\n") != strings.Join(lines, "\n") {
+		t.Errorf("expected every line to be sent; got %q\n", sent)
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
 	"golang.org/x/crypto/bcrypt"
+	"suah.dev/mcchunkie/chats/format"
 	"suah.dev/mcchunkie/mcstore"
 	"suah.dev/mcchunkie/plugins"
 )
@@ -19,17 +21,30 @@ func (s *SMSChat) Name() string {
 	return "SMS"
 }
 
-func (s *SMSChat) Send(string, string) error {
-	return nil
+func (s *SMSChat) Send(string, string) (string, error) {
+	return "", nil
 }
 
-func smsCanSend(number string, numbers []string) bool {
-	for _, s := range numbers {
-		if number == s {
-			return true
-		}
+// Format is plain text.
+func (s *SMSChat) Format() format.Format {
+	return format.Plain
+}
+
+// Limits keeps to single part SMS messages and doesn't send too many of
+// them.
+func (s *SMSChat) Limits() format.Limits {
+	return format.Limits{MaxBytes: 160, Multiline: true, MaxLines: 8}
+}
+
+func (sc *SMSChat) messageContext(from, to string) *plugins.MessageContext {
+	return &plugins.MessageContext{
+		Chat:        sc.Name(),
+		Room:        from,
+		Sender:      from,
+		DisplayName: from,
+		Direct:      true,
+		BotName:     to,
 	}
-	return false
 }
 
 type voipms struct {
@@ -71,16 +86,18 @@ func sendVoipmsResp(v voipms) error {
 }
 
 // SMSListen listens for our incoming sms
-func (sc *SMSChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) error {
+func (sc *SMSChat) Connect(store *mcstore.MCStore, d *Dispatcher) error {
 	smsPort, err := store.Get("sms_listen")
 	if err != nil {
 		return err
 	}
-	smsAllowed, err := store.Get("sms_users")
-	if err != nil {
-		return err
+	// Anyone can send us an SMS, only talk to the numbers that are
+	// allowed unless SMS was opened up on purpose (see plugins.RoleOf).
+	_, usersErr := store.Get("sms_users")
+	_, restrictedErr := store.Get("acl_restricted")
+	if usersErr != nil && restrictedErr != nil {
+		return fmt.Errorf("SMS: set sms_users or acl_restricted")
 	}
-	smsUsers := strings.Split(smsAllowed, ",")
 	voipmsUser, err := store.Get("voipms_user")
 	if err != nil {
 		return err
@@ -139,43 +156,25 @@ func (sc *SMSChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) err
 				from = r.URL.Query().Get("from")
 				to := r.URL.Query().Get("to")
 
-				for _, p := range *plugins {
-					if p.Match(from, msg) {
-						log.Printf("%s: responding to '%s'", p.Name(), from)
-						p.SetStore(store)
-
-						resp, delayedResp := p.Process(from, msg)
-						if resp != "" {
-							err := sendVoipmsResp(voipms{
-								did:         to,
-								dst:         from,
-								message:     resp,
-								method:      "sendSMS",
-								apiUser:     voipmsUser,
-								apiPassword: voipmsPass,
-							})
-							if err != nil {
-								log.Println(err)
-							}
-							go func() {
-								resp := delayedResp()
-								if resp != "" {
-									err := sendVoipmsResp(voipms{
-										did:         to,
-										dst:         from,
-										message:     resp,
-										method:      "sendSMS",
-										apiUser:     voipmsUser,
-										apiPassword: voipmsPass,
-									})
-									if err != nil {
-										log.Println(err)
-									}
-								}
-							}()
+				msgCtx := sc.messageContext(from, to)
+				d.Dispatch(msgCtx, msg, func(resp *plugins.Response) (string, error) {
+					c := split(sc, resp)
+					d.Pager.Hold(msgCtx, plugins.KindText, c.Rest)
+					for _, m := range c.Messages {
+						err := sendVoipmsResp(voipms{
+							did:         to,
+							dst:         from,
+							message:     m,
+							method:      "sendSMS",
+							apiUser:     voipmsUser,
+							apiPassword: voipmsPass,
+						})
+						if err != nil {
+							return "", err
 						}
 					}
-				}
+					return "", nil
+				})
 				return
 			default:
 				http.Error(
@@ -186,7 +185,8 @@ func (sc *SMSChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) err
 				return
 			}
 
-			if smsCanSend(from, smsUsers) {
+			msgCtx := sc.messageContext(from, r.Form.Get("To"))
+			if plugins.RoleOf(store, msgCtx) > plugins.RoleNone {
 				msg = strings.TrimSuffix(msg, "\n")
 
 				if msg == "" {
@@ -194,23 +194,25 @@ func (sc *SMSChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) err
 					return
 				}
 
-				for _, p := range *plugins {
-					if p.Match(from, msg) {
-						log.Printf("%s: responding to '%s'", p.Name(), from)
-						p.SetStore(store)
-
-						resp, delayedResp := p.Process(from, msg)
-						if resp != "" {
-							fmt.Fprint(w, resp)
-							go func() {
-								dresp := delayedResp()
-								if dresp != "" {
-									fmt.Fprint(w, dresp)
-								}
-							}()
-						}
+				// Responses can only be written while we are handling the
+				// request, so wait for them. Delayed responses that show up
+				// later are dropped.
+				var mu sync.Mutex
+				done := false
+				<-d.Dispatch(msgCtx, msg, func(resp *plugins.Response) (string, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					if done {
+						return "", fmt.Errorf("request for %q already finished", from)
 					}
-				}
+					c := split(sc, resp)
+					d.Pager.Hold(msgCtx, plugins.KindText, c.Rest)
+					_, err := fmt.Fprint(w, strings.Join(c.Messages, "\n"))
+					return "", err
+				})
+				mu.Lock()
+				done = true
+				mu.Unlock()
 			} else {
 				log.Printf("number not allowed (%q)", from)
 				http.Error(
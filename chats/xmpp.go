@@ -3,10 +3,13 @@ package chats
 import (
 	// "github.com/agl/xmpp-client/xmpp"
 
+	"fmt"
 	"log"
+	"strings"
 
 	"gosrc.io/xmpp"
 	"gosrc.io/xmpp/stanza"
+	"suah.dev/mcchunkie/chats/format"
 	"suah.dev/mcchunkie/mcstore"
 	"suah.dev/mcchunkie/plugins"
 )
@@ -14,16 +17,65 @@ import (
 type XMPPChat struct {
 }
 
-func (x *XMPPChat) Send(string, string) error {
-	return nil
+func (x *XMPPChat) Send(string, string) (string, error) {
+	return "", nil
+}
+
+// Format uses XEP-0393 message styling.
+func (x *XMPPChat) Format() format.Format {
+	return format.XMPP
 }
 
 func (x *XMPPChat) Name() string {
 	return "XMPP"
 }
 
+// Limits keeps messages under the stanza size servers typically allow.
+func (x *XMPPChat) Limits() format.Limits {
+	return format.Limits{MaxBytes: 8 * 1024, Multiline: true, MaxLines: 30}
+}
+
+// bodies renders a plugin response as message bodies. Lines that didn't
+// fit are returned as well.
+func (x *XMPPChat) bodies(resp *plugins.Response) ([]string, []string) {
+	body := "%s"
+	if resp.Kind == plugins.KindEmote {
+		// XEP-0245
+		body = "/me %s"
+		resp = plugins.Text(resp.Text)
+	}
+
+	var bodies []string
+	c := split(x, resp)
+	for _, msg := range c.Messages {
+		bodies = append(bodies, fmt.Sprintf(body, msg))
+	}
+	return bodies, c.Rest
+}
+
+// messageContext describes msg for plugins. People chatting with us are
+// known by their bare JID, in group chats all messages come from the room
+// so participants are known by "room/nick".
+func (x *XMPPChat) messageContext(msg stanza.Message, jid string) *plugins.MessageContext {
+	sender, nick, _ := strings.Cut(msg.From, "/")
+	name, _, _ := strings.Cut(sender, "@")
+	group := msg.Type == stanza.MessageTypeGroupchat
+	if group {
+		sender, name = msg.From, nick
+	}
+	return &plugins.MessageContext{
+		Chat:        x.Name(),
+		Room:        msg.From,
+		Sender:      sender,
+		DisplayName: name,
+		Direct:      !group,
+		BotName:     jid,
+		MessageID:   msg.Id,
+	}
+}
+
 // XMPPConnect connects to our irc server
-func (x *XMPPChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) error {
+func (x *XMPPChat) Connect(store *mcstore.MCStore, d *Dispatcher) error {
 	jid, _ := store.Get("xmpp_jid")
 	pass, _ := store.Get("xmpp_pass")
 	server, _ := store.Get("xmpp_server")
@@ -40,32 +92,24 @@ func (x *XMPPChat) Connect(store *mcstore.MCStore, plugins *plugins.Plugins) err
 	router := xmpp.NewRouter()
 	router.HandleFunc("message", func(s xmpp.Sender, p stanza.Packet) {
 		msg, ok := p.(stanza.Message)
-		if !ok {
+		if !ok || msg.Body == "" {
 			return
 		}
 
-		resp := ""
-		delayedResp := func() string { return "" }
-		for _, p := range *plugins {
-			if p.Match(msg.From, msg.Body) {
-				log.Printf("%s: responding to '%s'", p.Name(), msg.From)
-				p.SetStore(store)
-				resp, delayedResp = p.Process(msg.From, msg.Body)
-			}
-		}
-		if resp != "" {
+		msgCtx := x.messageContext(msg, jid)
+
+		d.Dispatch(msgCtx, msg.Body, func(resp *plugins.Response) (string, error) {
 			log.Printf("XMPP: sending: %q to %q\n", resp, msg.From)
-			reply := stanza.Message{Attrs: stanza.Attrs{To: msg.From}, Body: resp}
-			_ = s.Send(reply)
-			go func() {
-				dresp := delayedResp()
-				if dresp != "" {
-					log.Printf("XMPP: sending: %q to %q\n", dresp, msg.From)
-					reply := stanza.Message{Attrs: stanza.Attrs{To: msg.From}, Body: dresp}
-					_ = s.Send(reply)
+			bodies, rest := x.bodies(resp)
+			d.Pager.Hold(msgCtx, plugins.KindText, rest)
+			for _, body := range bodies {
+				reply := stanza.Message{Attrs: stanza.Attrs{To: msg.From}, Body: body}
+				if err := s.Send(reply); err != nil {
+					return "", err
 				}
-			}()
-		}
+			}
+			return "", nil
+		})
 	})
 
 	client, err := xmpp.NewClient(config, router, func(err error) {
@@ -0,0 +1,28 @@
+package chats
+
+import (
+	"testing"
+
+	"gosrc.io/xmpp/stanza"
+)
+
+func TestXMPPSender(t *testing.T) {
+	x := &XMPPChat{}
+
+	testSenders := []struct {
+		msg    stanza.Message
+		sender string
+		name   string
+	}{
+		{stanza.Message{Attrs: stanza.Attrs{From: "qbit@tapenet.org/phone", Type: stanza.MessageTypeChat}}, "qbit@tapenet.org", "qbit"},
+		{stanza.Message{Attrs: stanza.Attrs{From: "room@muc.tapenet.org/qbit", Type: stanza.MessageTypeGroupchat}}, "room@muc.tapenet.org/qbit", "qbit"},
+		{stanza.Message{Attrs: stanza.Attrs{From: "room@muc.tapenet.org/other", Type: stanza.MessageTypeGroupchat}}, "room@muc.tapenet.org/other", "other"},
+	}
+
+	for _, ts := range testSenders {
+		mc := x.messageContext(ts.msg, "mcchunkie@tapenet.org")
+		if mc.Sender != ts.sender || mc.DisplayName != ts.name {
+			t.Errorf("%q: expected %q (%q); got %q (%q)\n", ts.msg.From, ts.sender, ts.name, mc.Sender, mc.DisplayName)
+		}
+	}
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"slices"
-	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"suah.dev/mcchunkie/chats"
@@ -25,38 +27,192 @@ const header = `
 
 A Matrix, XMPP, IRC, Mail and SMS chat bot.`
 
+// archiveFormat returns the export format for the file name, see
+// mcstore.MCStore.Export.
+func archiveFormat(name string) string {
+	if strings.HasSuffix(name, ".tar") {
+		return "tar"
+	}
+	return "json"
+}
+
+// flagNames splits the comma separated names given to -opt, exiting if
+// one of them isn't in known.
+func flagNames(opt, list string, known []string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.ContainsFunc(known, func(k string) bool {
+			return strings.EqualFold(k, name)
+		}) {
+			log.Fatalf("-%s: unknown name %q, expected one of: %s", opt, name, strings.Join(known, ", "))
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// reportTargets returns the "chat:room" entries of "report_rooms", where
+// owners are told about failing plugins. If it isn't set the owners are
+// messaged directly, which only works on chats that can send to people,
+// like IRC and Signal.
+func reportTargets(store *mcstore.MCStore) []string {
+	if rooms := plugins.List(store, "report_rooms"); len(rooms) > 0 {
+		return rooms
+	}
+	return plugins.Members(store, plugins.RoleOwner)
+}
+
 func main() {
 	var db string
 	var key, value, get, disableChats, disablePlugins string
-	var doc bool
+	var list, del, export, imp, secretKeyFile string
+	var doc, stdin, redact, seal bool
 
 	flag.BoolVar(&doc, "doc", false, "print plugin information and exit")
 	flag.StringVar(&db, "db", "db", "full path to database directory")
 	flag.StringVar(&get, "get", "", "grab an entry from the store")
 	flag.StringVar(&key, "key", "", "create an entry in the data store listed under 'key'")
 	flag.StringVar(&value, "value", "", "set the value of 'key' to be stored")
+	flag.BoolVar(&stdin, "stdin", false, "read the value of 'key' from stdin, for multi-line values")
+	flag.StringVar(&list, "list", "", "list the entries matching a glob, '*' for all (entries in buckets are 'bucket/key')")
+	flag.StringVar(&del, "del", "", "delete an entry from the store")
+	flag.StringVar(&export, "export", "", "export the store to a file, '-' for stdout (files ending in .tar are tar archives, anything else JSON)")
+	flag.StringVar(&imp, "import", "", "import entries exported with -export, '-' for stdin")
+	flag.StringVar(&secretKeyFile, "secretkey", "", "file holding the key secrets are encrypted with, 32 bytes in hex\nDefaults to $"+mcstore.SecretKeyEnv)
+	flag.BoolVar(&seal, "seal", false, "encrypt the secrets still stored in plain text")
+	flag.BoolVar(&redact, "redact", false, "replace passwords, tokens and keys with "+mcstore.Redacted+" when exporting")
 	flag.StringVar(&disableChats, "dc", "", fmt.Sprintf("comma delimited list of chat types to disable (case insensitive)\nEnabled by default: %s", chats.ChatMethods.List()))
 	flag.StringVar(&disablePlugins, "dp", "", fmt.Sprintf("comma delimited list of plugin types to disable (case insensitive)\nEnabled by default: %s", plugins.Plugs.List()))
 
 	flag.Parse()
 
-	_ = protect.Pledge("stdio unveil rpath wpath cpath flock dns inet tty")
+	store, err := mcstore.NewStore(db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	secretKey, err := mcstore.ReadSecretKey(secretKeyFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if secretKey != nil {
+		if err := store.SetSecretKey(secretKey); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// Exec plugins need to be known before we pledge and unveil, we only
+	// allow running other programs when some are configured.
+	execPlugs, err := plugins.LoadExecPlugins(store)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	promises := "stdio unveil rpath wpath cpath flock dns inet tty"
+	if len(execPlugs) > 0 {
+		promises += " proc exec"
+	}
+	_ = protect.Pledge(promises)
 	_ = protect.Unveil("/etc/resolv.conf", "r")
 	_ = protect.Unveil("/etc/ssl/cert.pem", "r")
 	_ = protect.Unveil(db, "rwc")
+	if export != "" && export != "-" {
+		_ = protect.Unveil(export, "rwc")
+	}
+	if imp != "" && imp != "-" {
+		_ = protect.Unveil(imp, "r")
+	}
+	for _, p := range execPlugs {
+		paths, err := p.Paths()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, path := range paths {
+			_ = protect.Unveil(path, "rx")
+		}
+	}
 
-	var err = protect.UnveilBlock()
+	err = protect.UnveilBlock()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	store, err := mcstore.NewStore(db)
-	if err != nil {
-		log.Fatalln(err)
+	if key != "" && stdin {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		value = strings.TrimSuffix(string(b), "\n")
+		if value == "" {
+			log.Fatal("no value on stdin, use -del to delete an entry")
+		}
 	}
 
 	if key != "" && value != "" {
-		store.Set(key, value)
+		if err := store.Set(key, value); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if seal {
+		n, err := store.Seal()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("encrypted %d secrets", n)
+		os.Exit(0)
+	}
+
+	if list != "" {
+		keys, err := store.Keys(list)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, k := range keys {
+			fmt.Println(k)
+		}
+		os.Exit(0)
+	}
+
+	if del != "" {
+		if err := store.Delete(del); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if export != "" {
+		w := os.Stdout
+		if export != "-" {
+			if w, err = os.OpenFile(export, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := store.Export(w, archiveFormat(export), redact); err != nil {
+			log.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if imp != "" {
+		r := os.Stdin
+		if imp != "-" {
+			if r, err = os.Open(imp); err != nil {
+				log.Fatal(err)
+			}
+		}
+		n, err := store.Import(r, archiveFormat(imp))
+		if err != nil {
+			log.Fatalf("imported %d entries: %s", n, err)
+		}
+		log.Printf("imported %d entries", n)
 		os.Exit(0)
 	}
 
@@ -79,19 +235,57 @@ func main() {
 		os.Exit(0)
 	}
 
-	disableList := strings.Split(strings.ToLower(disableChats), ",")
+	var chatNames []string
+	for _, c := range chats.ChatMethods {
+		chatNames = append(chatNames, c.Name())
+	}
+	disableList := flagNames("dc", disableChats, chatNames)
 	chatEnabled := func(chat string) bool {
-		if slices.Contains(disableList, strings.ToLower(chat)) {
-			return false
+		return !slices.ContainsFunc(disableList, func(name string) bool {
+			return strings.EqualFold(name, chat)
+		})
+	}
+	if err := plugins.MigrateACL(store); err != nil {
+		log.Fatalln(err)
+	}
+
+	plugs := plugins.Plugs
+	for _, p := range execPlugs {
+		plugs = append(plugs, p)
+	}
+	var plugNames []string
+	for _, p := range plugs {
+		plugNames = append(plugNames, p.Name())
+	}
+	plugs = plugs.Without(flagNames("dp", disablePlugins, plugNames))
+	d, err := chats.NewDispatcher(store, plugs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	d.Report = func(msg string) {
+		for _, to := range reportTargets(store) {
+			chat, id, ok := strings.Cut(to, ":")
+			i := slices.IndexFunc(chats.ChatMethods, func(c chats.Chat) bool {
+				return strings.EqualFold(c.Name(), chat)
+			})
+			if !ok || i < 0 || !chatEnabled(chats.ChatMethods[i].Name()) {
+				log.Printf("can't report to %q, report_rooms needs \"chat:room\" entries of enabled chats", to)
+				continue
+			}
+			c := chats.ChatMethods[i]
+			if _, err := c.Send(id, msg); err != nil {
+				log.Printf("%s: can't report to %q: %s", c.Name(), id, err)
+			}
 		}
-		return true
 	}
+	d.Init()
+
 	for _, chat := range chats.ChatMethods {
 		go func() {
 			if chatEnabled(chat.Name()) {
 				for {
 					log.Printf("Starting %s...", chat.Name())
-					err := chat.Connect(store, &plugins.Plugs)
+					err := chat.Connect(store, d)
 					if err != nil {
 						log.Println(fmt.Errorf("%s: %q", chat.Name(), err))
 					}
@@ -104,59 +298,19 @@ func main() {
 	gotChat, err := chats.ChatMethods.ByName("IRC")
 	go chats.GotListen(store, gotChat)
 
-	for {
-		errataCount := 0
-		storeCount, err := store.Get("errata_count")
-		if err != nil {
-			log.Fatal(err)
-		}
-		openbsdRelease, err := store.Get("openbsd_release")
-		if err != nil {
-			log.Fatal(err)
-		}
-		errataCount, err = strconv.Atoi(storeCount)
-
-		got, err := ParseRemoteErrata(
-			fmt.Sprintf("http://ftp.openbsd.org/pub/OpenBSD/patches/%s/common/",
-				openbsdRelease,
-			),
-		)
-		if err != nil {
-			fmt.Println(err)
-			time.Sleep(2 * time.Hour)
-			continue
-		}
-		l := len(got.List)
-		if l > errataCount {
-			alertRooms, err := store.Get("errata_rooms")
-			if err != nil {
-				log.Fatal(err)
-			}
-			c := 0
-			for _, erratum := range got.List {
-				if c+1 > errataCount {
-					log.Printf("Notifying for erratum %03d\n", erratum.ID)
-					err = erratum.Fetch()
-					if err != nil {
-						fmt.Println(err)
-						break
-					}
-					for _, room := range strings.Split(alertRooms, ",") {
-						for _, c := range chats.ChatMethods {
-							if chatEnabled(c.Name()) {
-								err = c.Send(room, PrintErrataMD(&erratum))
-								if err != nil {
-									log.Printf("%s: %q", c.Name(), err)
-								}
-							}
-						}
-					}
+	d.Schedule(func(room, message string) {
+		for _, c := range chats.ChatMethods {
+			if chatEnabled(c.Name()) {
+				_, err := c.Send(room, message)
+				if err != nil {
+					log.Printf("%s: %q", c.Name(), err)
 				}
-				c = c + 1
 			}
-			errataCount = l
 		}
-		store.Set("errata_count", strconv.Itoa(l))
-		time.Sleep(2 * time.Hour)
-	}
+	})
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	log.Printf("Shutting down (%s)", <-sigs)
+	d.Close()
 }
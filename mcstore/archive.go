@@ -0,0 +1,206 @@
+package mcstore
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Redacted replaces the values of secrets in redacted exports. Importing
+// it leaves the key alone.
+const Redacted = "<redacted>"
+
+// walk calls fn for each key that is set, with its value as stored. Keys in
+// buckets are "<bucket>/<key>".
+func (s MCStore) walk(fn func(key string, value []byte) error) error {
+	return walkDir(s.dir, "", fn)
+}
+
+func walkDir(dir, prefix string, fn func(string, []byte) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || e.IsDir() {
+			continue
+		}
+		key, err := KeyName(e.Name())
+		if err != nil {
+			return err
+		}
+		value, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(value)) == "" {
+			continue
+		}
+		if err := fn(prefix+key, value); err != nil {
+			return err
+		}
+	}
+
+	buckets, err := os.ReadDir(filepath.Join(dir, bucketDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		if !b.IsDir() {
+			continue
+		}
+		name, err := KeyName(b.Name())
+		if err != nil {
+			return err
+		}
+		if err := walkDir(filepath.Join(dir, bucketDir, b.Name()), prefix+name+"/", fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keys returns the keys that are set and match pattern (see path.Match),
+// "*" doesn't match the "/" of keys in buckets.
+func (s MCStore) Keys(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var keys []string
+	err := s.walk(func(key string, _ []byte) error {
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// archiveEntry is a key in a JSON export. Values that aren't text, like
+// the rooms gomatrix saves, are kept in Base64.
+type archiveEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Base64 []byte `json:"base64,omitempty"`
+}
+
+// Export writes every key of the store to w, as a tar archive with a file
+// per key if format is "tar", as JSON otherwise. With redact the values of
+// secrets (see Secret) are replaced with Redacted, otherwise encrypted
+// secrets are exported as they are stored.
+func (s MCStore) Export(w io.Writer, format string, redact bool) error {
+	value := func(key string, v []byte) []byte {
+		if redact && Secret(key) {
+			return []byte(Redacted)
+		}
+		return v
+	}
+
+	if format == "tar" {
+		tw := tar.NewWriter(w)
+		now := time.Now()
+		err := s.walk(func(key string, v []byte) error {
+			v = value(key, v)
+			if err := tw.WriteHeader(&tar.Header{
+				Name:    key,
+				Mode:    0600,
+				Size:    int64(len(v)),
+				ModTime: now,
+			}); err != nil {
+				return err
+			}
+			_, err := tw.Write(v)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return tw.Close()
+	}
+
+	entries := []archiveEntry{}
+	err := s.walk(func(key string, v []byte) error {
+		v = value(key, v)
+		e := archiveEntry{Key: key}
+		if utf8.Valid(v) {
+			e.Value = string(v)
+		} else {
+			e.Base64 = v
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// Import sets the keys read from r, an export in format (see Export), and
+// returns how many it set. Keys that aren't in the export are left alone,
+// as are redacted ones.
+func (s MCStore) Import(r io.Reader, format string) (int, error) {
+	n := 0
+	set := func(key string, v []byte) error {
+		if string(v) == Redacted {
+			return nil
+		}
+		if err := s.Set(key, string(v)); err != nil {
+			return err
+		}
+		n++
+		return nil
+	}
+
+	if format == "tar" {
+		tr := tar.NewReader(r)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				return n, nil
+			}
+			if err != nil {
+				return n, err
+			}
+			if h.Typeflag != tar.TypeReg {
+				continue
+			}
+			v, err := io.ReadAll(tr)
+			if err != nil {
+				return n, err
+			}
+			if err := set(h.Name, v); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	var entries []archiveEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return n, fmt.Errorf("invalid export: %w", err)
+	}
+	for _, e := range entries {
+		v := []byte(e.Value)
+		if e.Base64 != nil {
+			v = e.Base64
+		}
+		if err := set(e.Key, v); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,98 @@
+package mcstore
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestKeys(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"irc_pass", "irc_rooms", "sms_htpass", "weather/api_key", "../odd", "unset"} {
+		s.Set(k, k)
+	}
+	s.Set("unset", "")
+
+	testPatterns := map[string]string{
+		"*":     "[irc_pass irc_rooms sms_htpass]",
+		"irc_*": "[irc_pass irc_rooms]",
+		"*/*":   "[weather/api_key ../odd]",
+	}
+	for pattern, want := range testPatterns {
+		keys, err := s.Keys(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(keys) != want {
+			t.Errorf("%q: expected %s; got %s\n", pattern, want, keys)
+		}
+	}
+	if _, err := s.Keys("["); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+
+	if err := s.Delete("weather/api_key"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Has("weather/api_key") {
+		t.Error("expected the key to be deleted")
+	}
+	if err := s.Delete("weather/api_key"); err == nil {
+		t.Error("expected an error deleting a missing key")
+	}
+}
+
+func TestExport(t *testing.T) {
+	values := map[string]string{
+		"irc_pass":              "hunter2",
+		"irc_rooms":             "#a,#b",
+		"sms_htpass":            "line1\nline2",
+		"weather/api_key":       "1234",
+		"room_!abc:tapenet.org": "\xff\x00gob",
+	}
+
+	for _, format := range []string{"json", "tar"} {
+		for _, redact := range []bool{false, true} {
+			from, err := NewStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range values {
+				from.Set(k, v)
+			}
+			var buf bytes.Buffer
+			if err := from.Export(&buf, format, redact); err != nil {
+				t.Fatal(err)
+			}
+			if redact && strings.Contains(buf.String(), "hunter2") {
+				t.Errorf("%s: expected secrets to be redacted\n", format)
+			}
+
+			to, err := NewStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			to.Set("irc_pass", "kept")
+			n, err := to.Import(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]int{false: 5, true: 2}[redact]; n != want {
+				t.Errorf("%s, redact %t: expected %d entries; got %d\n", format, redact, want, n)
+			}
+			for k, v := range values {
+				want := strings.TrimSpace(v)
+				if redact && Secret(k) {
+					want = map[string]string{"irc_pass": "kept"}[k]
+				}
+				if got, _ := to.Get(k); got != want {
+					t.Errorf("%s, redact %t: %q: expected %q; got %q\n", format, redact, k, want, got)
+				}
+			}
+		}
+	}
+}
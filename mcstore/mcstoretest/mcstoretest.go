@@ -0,0 +1,23 @@
+// Package mcstoretest provides a store for tests that don't need files.
+package mcstoretest
+
+import "fmt"
+
+// Map is a store kept in a map. Like MCStore, getting a key that was never
+// set is an error.
+type Map map[string]string
+
+// Set sets key to value
+func (m Map) Set(key, value string) error {
+	m[key] = value
+	return nil
+}
+
+// Get returns the value of key, or an error if it doesn't exist
+func (m Map) Get(key string) (string, error) {
+	v, ok := m[key]
+	if !ok {
+		return "", fmt.Errorf("no entry for %q", key)
+	}
+	return v, nil
+}
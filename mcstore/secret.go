@@ -0,0 +1,144 @@
+package mcstore
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// SecretKeyEnv is the environment variable holding the key secrets are
+// encrypted with, when it isn't read from a file.
+const SecretKeyEnv = "MCCHUNKIE_SECRET_KEY"
+
+// sealedPrefix starts encrypted values, the rest is the nonce and the
+// ciphertext in base64.
+const sealedPrefix = "enc:v1:"
+
+// secretKey matches the names of keys holding passwords, tokens and the
+// like: "irc_pass", "sms_htpass", "matrix_access_token", "weather_api_key"
+// and the "simple_login_api_<user>" keys of users.
+var secretKey = regexp.MustCompile(`(?i)(^|_)(api|pass|password|htpass|token|secret|key)(_|$)`)
+
+// Secret reports whether key holds a secret. Per user keys, which are
+// base32 encoded, are checked by their decoded name.
+func Secret(key string) bool {
+	name := path.Base(key)
+	if b, err := base32.StdEncoding.DecodeString(name); err == nil {
+		name = string(b)
+	}
+	return secretKey.MatchString(name)
+}
+
+// ReadSecretKey reads the key secrets are encrypted with from file or, if
+// file is "", from SecretKeyEnv. Keys are 32 bytes written in hex, like
+// the output of "openssl rand -hex 32". There is no key if neither is set.
+func ReadSecretKey(file string) ([]byte, error) {
+	s := os.Getenv(SecretKeyEnv)
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		s = string(b)
+	}
+	if s = strings.TrimSpace(s); s == "" {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("invalid secret key, expected %d bytes in hex", chacha20poly1305.KeySize)
+	}
+	return key, nil
+}
+
+// SetSecretKey makes s encrypt secrets (see Secret) with key, using
+// XChaCha20-Poly1305. Secrets that are already stored stay as they are
+// until they are set again, see Seal.
+func (s *MCStore) SetSecretKey(key []byte) error {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	s.aead = aead
+	return nil
+}
+
+// sealed reports whether the stored value raw is encrypted.
+func sealed(raw string) bool {
+	return strings.HasPrefix(raw, sealedPrefix)
+}
+
+// sealing reports whether value is encrypted when key is set to it.
+// Values that are encrypted already, from an export for example, are
+// stored as they are.
+func (s MCStore) sealing(key, value string) bool {
+	return s.aead != nil && value != "" && !sealed(value) && Secret(s.prefix+key)
+}
+
+// seal returns what to store for key to be set to value.
+func (s MCStore) seal(key, value string) (string, error) {
+	if !s.sealing(key, value) {
+		return value, nil
+	}
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(value)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	b := s.aead.Seal(nonce, nonce, []byte(value), []byte(s.prefix+key))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// open returns the value of key from what is stored, raw.
+func (s MCStore) open(key, raw string) (string, error) {
+	if !sealed(raw) {
+		return raw, nil
+	}
+	if s.aead == nil {
+		return "", fmt.Errorf("%q is encrypted and there is no secret key", key)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(raw, sealedPrefix))
+	if err != nil || len(b) < s.aead.NonceSize() {
+		return "", fmt.Errorf("%q is not a valid encrypted value", key)
+	}
+	nonce, ciphertext := b[:s.aead.NonceSize()], b[s.aead.NonceSize():]
+	value, err := s.aead.Open(nil, nonce, ciphertext, []byte(s.prefix+key))
+	if err != nil {
+		return "", fmt.Errorf("can't decrypt %q, is it the right secret key? %w", key, err)
+	}
+	return string(value), nil
+}
+
+// Seal encrypts the secrets that are still stored in plain text and
+// returns how many there were.
+func (s MCStore) Seal() (int, error) {
+	if s.aead == nil {
+		return 0, fmt.Errorf("no secret key")
+	}
+	var keys []string
+	err := s.walk(func(key string, value []byte) error {
+		if Secret(s.prefix+key) && !sealed(strings.TrimSpace(string(value))) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, key := range keys {
+		if err := s.Update(key, func(v string) (string, error) {
+			return v, nil
+		}); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,106 @@
+package mcstore
+
+import (
+	"encoding/base32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	testKeys := map[string]bool{
+		"irc_pass":            true,
+		"sms_htpass":          true,
+		"matrix_access_token": true,
+		"weather/api_key":     true,
+		"mail_password":       true,
+		"voipms_api_pass":     true,
+		base32.StdEncoding.EncodeToString([]byte("simple_login_api_@qbit:tapenet.org")): true,
+		"irc_rooms":                    false,
+		"errata_count":                 false,
+		"monkey_rooms":                 false,
+		"batch_@mcchunkie:tapenet.org": false,
+	}
+	for key, want := range testKeys {
+		if got := Secret(key); got != want {
+			t.Errorf("%q: expected %t; got %t\n", key, want, got)
+		}
+	}
+}
+
+func TestReadSecretKey(t *testing.T) {
+	hexKey := strings.Repeat("ab", 32)
+
+	t.Setenv(SecretKeyEnv, "")
+	if key, err := ReadSecretKey(""); err != nil || key != nil {
+		t.Errorf("expected no key; got %x (%v)\n", key, err)
+	}
+
+	t.Setenv(SecretKeyEnv, hexKey)
+	if key, err := ReadSecretKey(""); err != nil || len(key) != 32 {
+		t.Errorf("expected the key from the environment; got %x (%v)\n", key, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(file, []byte("abcd\n"), 0600)
+	if _, err := ReadSecretKey(file); err == nil {
+		t.Error("expected an error for a short key")
+	}
+	os.WriteFile(file, []byte(hexKey+"\n"), 0600)
+	if key, err := ReadSecretKey(file); err != nil || len(key) != 32 {
+		t.Errorf("expected the key from the file; got %x (%v)\n", key, err)
+	}
+}
+
+func TestSeal(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("irc_pass", "hunter2")
+
+	if err := s.SetSecretKey([]byte(strings.Repeat("k", 32))); err != nil {
+		t.Fatal(err)
+	}
+	s.Set("xmpp_pass", "swordfish")
+	s.Set("irc_rooms", "#a,#b")
+	s.Bucket("weather").Set("api_key", "1234")
+
+	raw := func(name string) string {
+		b, _ := os.ReadFile(filepath.Join(dir, name))
+		return string(b)
+	}
+	if !sealed(raw("xmpp_pass")) || raw("irc_rooms") != "#a,#b" || raw("irc_pass") != "hunter2" {
+		t.Errorf("expected only new secrets to be encrypted; got %q, %q and %q\n", raw("xmpp_pass"), raw("irc_rooms"), raw("irc_pass"))
+	}
+	if v, err := s.Get("weather/api_key"); err != nil || v != "1234" {
+		t.Errorf("expected to read a secret set in a bucket from the store; got %q (%v)\n", v, err)
+	}
+
+	if n, err := s.Seal(); err != nil || n != 1 {
+		t.Errorf("expected to encrypt irc_pass; got %d (%v)\n", n, err)
+	}
+	if !sealed(raw("irc_pass")) {
+		t.Errorf("expected irc_pass to be encrypted; got %q\n", raw("irc_pass"))
+	}
+	for key, want := range map[string]string{"irc_pass": "hunter2", "xmpp_pass": "swordfish", "irc_rooms": "#a,#b"} {
+		if v, err := s.Get(key); err != nil || v != want {
+			t.Errorf("%q: expected %q; got %q (%v)\n", key, want, v, err)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "irc_pass"), []byte(raw("xmpp_pass")), 0600)
+	if _, err := s.Get("irc_pass"); err == nil {
+		t.Error("expected a secret moved to another key not to decrypt")
+	}
+
+	plain, _ := NewStore(dir)
+	if _, err := plain.Get("xmpp_pass"); err == nil {
+		t.Error("expected an error reading a secret without a key")
+	}
+	if _, err := plain.Seal(); err == nil {
+		t.Error("expected an error sealing without a key")
+	}
+}
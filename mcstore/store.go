@@ -2,18 +2,109 @@ package mcstore
 
 import (
 	"bytes"
+	"crypto/cipher"
+	"encoding/base32"
 	"encoding/gob"
 	"fmt"
 	"log"
 	"os"
-	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/matrix-org/gomatrix"
 )
 
-// MCStore is the path to a directory which will contain our data.
-type MCStore string
+// MCStore is a directory which will contain our data. Each key is a file.
+// Keys can be put in buckets, subdirectories of "buckets", with Bucket or
+// by prefixing them with the bucket name and a "/": "weather/api_key" is
+// "api_key" in the "weather" bucket. Secrets are encrypted once the store
+// has a key (see SetSecretKey).
+type MCStore struct {
+	dir string
+	// prefix is "<name>/" for buckets, the key of a secret in a bucket
+	// is sealed with the name it has in the store.
+	prefix string
+	aead   cipher.AEAD
+}
+
+// bucketDir holds the buckets of a store.
+const bucketDir = "buckets"
+
+// maxName is the longest file name we create.
+const maxName = 200
+
+// safeName matches key (and bucket) names that can be used as file names
+// as they are. Anything else is encoded (see fileName).
+var safeName = regexp.MustCompile(`^[A-Za-z0-9_@:!#+=,-][A-Za-z0-9_@:!#+=,.-]*$`)
+
+// encodedPrefix starts encoded file names, safeName never matches it.
+const encodedPrefix = "~"
+
+// fileName returns the file name for a key or bucket name. Names that
+// aren't safe to use as file names, like "../matrix_access_token", are
+// base32 encoded and prefixed with "~".
+func fileName(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty name")
+	}
+	if safeName.MatchString(name) && name != bucketDir && len(name) <= maxName {
+		return name, nil
+	}
+	enc := encodedPrefix + base32.StdEncoding.EncodeToString([]byte(name))
+	if len(enc) > maxName {
+		return "", fmt.Errorf("name too long: %q", name)
+	}
+	return enc, nil
+}
+
+// KeyName returns the key stored in the file called name, the reverse of
+// the encoding done for keys that aren't safe file names.
+func KeyName(name string) (string, error) {
+	enc, ok := strings.CutPrefix(name, encodedPrefix)
+	if !ok {
+		return name, nil
+	}
+	b, err := base32.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", fmt.Errorf("invalid file name %q: %w", name, err)
+	}
+	return string(b), nil
+}
+
+// file returns the path of the file holding key.
+func (s MCStore) file(key string) (string, error) {
+	parts := strings.Split(key, "/")
+	dir := s.dir
+	for _, b := range parts[:len(parts)-1] {
+		name, err := fileName(b)
+		if err != nil {
+			return "", fmt.Errorf("invalid key %q: %w", key, err)
+		}
+		dir = filepath.Join(dir, bucketDir, name)
+	}
+	name, err := fileName(parts[len(parts)-1])
+	if err != nil {
+		return "", fmt.Errorf("invalid key %q: %w", key, err)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Bucket returns the bucket called name. Keys in a bucket are kept apart
+// from those of the store and of other buckets.
+func (s MCStore) Bucket(name string) *MCStore {
+	dir, err := fileName(name)
+	if err != nil {
+		// Only names longer than we can store end up here, keep
+		// them apart anyway.
+		dir = encodedPrefix
+	}
+	return &MCStore{
+		dir:    filepath.Join(s.dir, bucketDir, dir),
+		prefix: s.prefix + name + "/",
+		aead:   s.aead,
+	}
+}
 
 // NewStore creates a new instance of FStore
 func NewStore(s string) (*MCStore, error) {
@@ -25,8 +116,7 @@ func NewStore(s string) (*MCStore, error) {
 	if !fi.IsDir() {
 		return nil, fmt.Errorf("not a directory")
 	}
-	fstore := MCStore(s)
-	return &fstore, nil
+	return &MCStore{dir: s}, nil
 }
 
 func (s *MCStore) encodeRoom(room *gomatrix.Room) ([]byte, error) {
@@ -50,26 +140,130 @@ func (s *MCStore) decodeRoom(room []byte) (*gomatrix.Room, error) {
 	return r, nil
 }
 
-// Set dumps value into a file named key
-func (s MCStore) Set(key string, value string) {
-	err := os.WriteFile(path.Join(string(s), key), []byte(value), 0600)
+// lockFile is the name of the lock file in each directory of the store,
+// safeName never matches it.
+const lockFile = ".lock"
+
+// Set dumps value into a file named key. The value is written to a
+// temporary file that replaces the old one once it is safely on disk, so a
+// crash can't leave a key half written. Writers, in this process or others
+// like "mcchunkie -key", take turns using an advisory lock. Setting key to
+// "" keeps an empty file, use Delete to remove it.
+func (s MCStore) Set(key string, value string) error {
+	return s.Update(key, func(string) (string, error) {
+		return value, nil
+	})
+}
+
+// Update replaces the value of key with what fn returns for the current
+// one, "" if key isn't set. Nobody else writes to the store while fn runs,
+// so Update can be used for counters and lists. Nothing is written if fn
+// returns an error or the value doesn't change.
+func (s MCStore) Update(key string, fn func(value string) (string, error)) error {
+	file, err := s.file(key)
 	if err != nil {
-		log.Println(err)
+		return err
+	}
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	unlock, err := lock(filepath.Join(dir, lockFile))
+	if err != nil {
+		return fmt.Errorf("can't lock %q: %w", dir, err)
+	}
+	defer unlock()
+
+	old, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	raw := strings.TrimSpace(string(old))
+	current, err := s.open(key, raw)
+	if err != nil {
+		return err
+	}
+	value, err := fn(current)
+	if err != nil {
+		return err
 	}
+	if old != nil && value == current && sealed(raw) == s.sealing(key, value) {
+		return nil
+	}
+	if value, err = s.seal(key, value); err != nil {
+		return err
+	}
+	return write(file, value)
+}
+
+// write replaces file with one holding value.
+func write(file, value string) error {
+	dir := filepath.Dir(file)
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+	return syncDir(dir)
 }
 
 // Get pulls value from a file named key
 func (s MCStore) Get(key string) (string, error) {
-	data, err := os.ReadFile(path.Join(string(s), key))
+	file, err := s.file(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(file)
 	if err != nil {
 		return "", fmt.Errorf("no entry for %q: %q", key, err)
 	}
-	return strings.TrimSpace(string(data)), nil
+	return s.open(key, strings.TrimSpace(string(data)))
+}
+
+// Delete removes key from the store.
+func (s MCStore) Delete(key string) error {
+	file, err := s.file(key)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(file); err != nil {
+		return fmt.Errorf("no entry for %q: %q", key, err)
+	}
+	dir := filepath.Dir(file)
+
+	unlock, err := lock(filepath.Join(dir, lockFile))
+	if err != nil {
+		return fmt.Errorf("can't lock %q: %w", dir, err)
+	}
+	defer unlock()
+
+	if err := os.Remove(file); err != nil {
+		return fmt.Errorf("no entry for %q: %q", key, err)
+	}
+	return syncDir(dir)
 }
 
 // SaveFilterID exposed for gomatrix
 func (s *MCStore) SaveFilterID(userID, filterID string) {
-	s.Set(fmt.Sprintf("filter_%s", userID), filterID)
+	if err := s.Set(fmt.Sprintf("filter_%s", userID), filterID); err != nil {
+		log.Println(err)
+	}
 }
 
 // LoadFilterID exposed for gomatrix
@@ -79,7 +273,9 @@ func (s *MCStore) LoadFilterID(userID string) string {
 }
 
 func (s *MCStore) SaveNextBatch(userID, nextBatchToken string) {
-	s.Set(fmt.Sprintf("batch_%s", userID), nextBatchToken)
+	if err := s.Set(fmt.Sprintf("batch_%s", userID), nextBatchToken); err != nil {
+		log.Println(err)
+	}
 }
 
 // LoadNextBatch exposed for gomatrix
@@ -91,7 +287,9 @@ func (s *MCStore) LoadNextBatch(userID string) string {
 // SaveRoom exposed for gomatrix
 func (s *MCStore) SaveRoom(room *gomatrix.Room) {
 	b, _ := s.encodeRoom(room)
-	s.Set(fmt.Sprintf("room_%s", room.ID), string(b))
+	if err := s.Set(fmt.Sprintf("room_%s", room.ID), string(b)); err != nil {
+		log.Println(err)
+	}
 }
 
 // LoadRoom exposed for gomatrix
@@ -0,0 +1,101 @@
+package mcstore
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFileName(t *testing.T) {
+	testNames := []struct {
+		name, file string
+	}{
+		{"matrix_access_token", "matrix_access_token"},
+		{"room_!abc:tapenet.org", "room_!abc:tapenet.org"},
+		{"filter_@mcchunkie:tapenet.org", "filter_@mcchunkie:tapenet.org"},
+		{"..", "~FYXA===="},
+		{".hidden", "~FZUGSZDEMVXA===="},
+		{"a/b", "~MEXWE==="},
+		{"~MEXWE===", "~PZGUKWCXIU6T2PI="},
+		{"buckets", "~MJ2WG23FORZQ===="},
+	}
+
+	for _, tn := range testNames {
+		file, err := fileName(tn.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file != tn.file {
+			t.Errorf("%q: expected %q; got %q\n", tn.name, tn.file, file)
+		}
+		if name, err := KeyName(file); err != nil || name != tn.name {
+			t.Errorf("%q: expected %q back; got %q (%v)\n", file, tn.name, name, err)
+		}
+	}
+
+	if _, err := fileName(""); err == nil {
+		t.Error("expected an error for an empty name")
+	}
+}
+
+func TestBucket(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Set("../escaped", "no")
+	s.Set("weather/api_key", "1234")
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escaped")); err == nil {
+		t.Error("expected keys to stay in the store")
+	}
+
+	if v, _ := s.Bucket("weather").Get("api_key"); v != "1234" {
+		t.Errorf("expected the weather bucket to have the key; got %q\n", v)
+	}
+	if v, _ := s.Get("api_key"); v != "" {
+		t.Errorf("expected the key to stay in its bucket; got %q\n", v)
+	}
+	if v, _ := s.Get("../escaped"); v != "no" {
+		t.Errorf("expected to read back encoded keys; got %q\n", v)
+	}
+}
+
+func TestSet(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]bool{}
+	var wg sync.WaitGroup
+	for i := range 20 {
+		v := strings.Repeat(strconv.Itoa(i), 1000)
+		values[v] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Set("batch_@mcchunkie:tapenet.org", v); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := s.Get("batch_@mcchunkie:tapenet.org"); !values[v] {
+		t.Errorf("expected one of the values to be written whole; got %q\n", v)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, ".tmp-*"))
+	if err != nil || len(files) != 0 {
+		t.Errorf("expected no temporary files to be left; got %q (%v)\n", files, err)
+	}
+
+	if err := s.Set("", "value"); err == nil {
+		t.Error("expected an error for an empty key")
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package mcstore
+
+import "sync"
+
+// locks stands in for flock(2), it only keeps writers in this process
+// from running into each other.
+var locks sync.Map
+
+// lock locks path for this process.
+func lock(path string) (func(), error) {
+	mu, _ := locks.LoadOrStore(path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock, nil
+}
+
+// syncDir does nothing, not every system can sync directories.
+func syncDir(string) error {
+	return nil
+}
@@ -0,0 +1,199 @@
+package mcstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// KV is a store of values, like MCStore or the stores plugins get. The
+// helpers below work with any of them.
+type KV interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+}
+
+// Updater is implemented by stores that can change a key without anyone
+// else writing to it in the meantime, like MCStore. fn gets the current
+// value, "" if the key isn't set, and returns the new one.
+type Updater interface {
+	Update(key string, fn func(value string) (string, error)) error
+}
+
+// updateMu makes updates of stores that aren't Updaters atomic, as long as
+// everyone goes through Update.
+var updateMu sync.Mutex
+
+// Update replaces the value of key in kv with what fn returns for the
+// current one.
+func Update(kv KV, key string, fn func(value string) (string, error)) error {
+	if u, ok := kv.(Updater); ok {
+		return u.Update(key, fn)
+	}
+
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	old, _ := kv.Get(key)
+	value, err := fn(old)
+	if err != nil || value == old {
+		return err
+	}
+	return kv.Set(key, value)
+}
+
+// Has reports whether key is set in kv.
+func Has(kv KV, key string) bool {
+	v, err := kv.Get(key)
+	return err == nil && v != ""
+}
+
+// GetJSON decodes the JSON value of key into v.
+func GetJSON(kv KV, key string, v any) error {
+	data, err := kv.Get(key)
+	if err != nil {
+		return err
+	}
+	if data == "" {
+		return fmt.Errorf("no entry for %q", key)
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return fmt.Errorf("invalid value for %q: %w", key, err)
+	}
+	return nil
+}
+
+// SetJSON sets key to v encoded as JSON.
+func SetJSON(kv KV, key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return kv.Set(key, string(b))
+}
+
+// Incr adds n to the number in key, which starts at 0, and returns the
+// result.
+func Incr(kv KV, key string, n int) (int, error) {
+	var i int
+	err := Update(kv, key, func(v string) (string, error) {
+		i = n
+		if v != "" {
+			c, err := strconv.Atoi(v)
+			if err != nil {
+				return "", fmt.Errorf("%q isn't a number: %w", key, err)
+			}
+			i += c
+		}
+		return strconv.Itoa(i), nil
+	})
+	return i, err
+}
+
+// List returns the entries of the comma separated list in key.
+func List(kv KV, key string) []string {
+	v, err := kv.Get(key)
+	if err != nil {
+		return nil
+	}
+	return SplitList(v)
+}
+
+// AddToSet adds the items that aren't in the list in key yet.
+func AddToSet(kv KV, key string, items ...string) error {
+	return updateList(kv, key, items, func(list []string) []string {
+		for _, item := range items {
+			if !slices.Contains(list, item) {
+				list = append(list, item)
+			}
+		}
+		return list
+	})
+}
+
+// AppendToList adds items to the end of the list in key, even if they
+// are in it already.
+func AppendToList(kv KV, key string, items ...string) error {
+	return updateList(kv, key, items, func(list []string) []string {
+		return append(list, items...)
+	})
+}
+
+// RemoveFromList removes every entry of the list in key that is one of
+// items.
+func RemoveFromList(kv KV, key string, items ...string) error {
+	return updateList(kv, key, items, func(list []string) []string {
+		return slices.DeleteFunc(list, func(e string) bool {
+			return slices.Contains(items, e)
+		})
+	})
+}
+
+func updateList(kv KV, key string, items []string, fn func([]string) []string) error {
+	for _, item := range items {
+		if item == "" || strings.Contains(item, ",") || strings.TrimSpace(item) != item {
+			return fmt.Errorf("invalid list entry %q", item)
+		}
+	}
+	return Update(kv, key, func(v string) (string, error) {
+		return strings.Join(fn(SplitList(v)), ","), nil
+	})
+}
+
+// SplitList returns the entries of the comma separated list s, without
+// the spaces around them.
+func SplitList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+// Has reports whether key is set.
+func (s MCStore) Has(key string) bool {
+	return Has(s, key)
+}
+
+// GetJSON decodes the JSON value of key into v.
+func (s MCStore) GetJSON(key string, v any) error {
+	return GetJSON(s, key, v)
+}
+
+// SetJSON sets key to v encoded as JSON.
+func (s MCStore) SetJSON(key string, v any) error {
+	return SetJSON(s, key, v)
+}
+
+// Incr adds n to the number in key, which starts at 0, and returns the
+// result.
+func (s MCStore) Incr(key string, n int) (int, error) {
+	return Incr(s, key, n)
+}
+
+// List returns the entries of the comma separated list in key.
+func (s MCStore) List(key string) []string {
+	return List(s, key)
+}
+
+// AddToSet adds the items that aren't in the list in key yet.
+func (s MCStore) AddToSet(key string, items ...string) error {
+	return AddToSet(s, key, items...)
+}
+
+// AppendToList adds items to the end of the list in key, even if they
+// are in it already.
+func (s MCStore) AppendToList(key string, items ...string) error {
+	return AppendToList(s, key, items...)
+}
+
+// RemoveFromList removes every entry of the list in key that is one of
+// items.
+func (s MCStore) RemoveFromList(key string, items ...string) error {
+	return RemoveFromList(s, key, items...)
+}
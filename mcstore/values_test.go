@@ -0,0 +1,89 @@
+package mcstore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestIncr(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Incr("errata_count", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n, err := s.Incr("errata_count", -10); err != nil || n != 40 {
+		t.Errorf("expected 40; got %d (%v)\n", n, err)
+	}
+
+	s.Set("irc_rooms", "#mcchunkie")
+	if _, err := s.Incr("irc_rooms", 1); err == nil {
+		t.Error("expected an error for a value that isn't a number")
+	}
+}
+
+func TestLists(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Set("irc_rooms", "#a, #b")
+	steps := []struct {
+		fn   func() error
+		want string
+	}{
+		{func() error { return s.AddToSet("irc_rooms", "#b", "#c") }, "[#a #b #c]"},
+		{func() error { return s.AppendToList("irc_rooms", "#a") }, "[#a #b #c #a]"},
+		{func() error { return s.RemoveFromList("irc_rooms", "#a", "#c") }, "[#b]"},
+		{func() error { return s.AddToSet("irc_rooms", "#d,#e") }, "[#b]"},
+		{func() error { return s.RemoveFromList("irc_rooms", "#b") }, "[]"},
+	}
+	for i, st := range steps {
+		st.fn()
+		if got := fmt.Sprint(s.List("irc_rooms")); got != st.want {
+			t.Errorf("%d: expected %s; got %s\n", i, st.want, got)
+		}
+	}
+	if s.Has("irc_rooms") {
+		t.Error("expected an empty list to be unset")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type reminder struct {
+		Who  string `json:"who"`
+		What string `json:"what"`
+	}
+	if err := s.SetJSON("remind/qbit", reminder{"qbit", "tea"}); err != nil {
+		t.Fatal(err)
+	}
+	var r reminder
+	if err := s.GetJSON("remind/qbit", &r); err != nil || r.What != "tea" {
+		t.Errorf("expected to read back the reminder; got %+v (%v)\n", r, err)
+	}
+	if err := s.GetJSON("remind/nobody", &r); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+	s.Set("remind/broken", "{")
+	if err := s.GetJSON("remind/broken", &r); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
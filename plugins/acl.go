@@ -0,0 +1,272 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Role is the level of trust we have in a user. Roles are ordered, a
+// higher role can do everything a lower one can.
+type Role int
+
+const (
+	// RoleNone is for people that we don't talk to at all.
+	RoleNone Role = iota
+	// RoleUser is the default role.
+	RoleUser
+	// RoleTrusted is for people that can use the more expensive plugins.
+	RoleTrusted
+	// RoleOwner runs the bot.
+	RoleOwner
+)
+
+// tapebotRelayRe matches the messages of tapebot, which can start with its
+// own name.
+const tapebotRelayRe = `^(?:tapebot )?<(?P<sender>[^>]+)> (?P<text>.*)$`
+
+// Roles that can be granted, from highest to lowest.
+var grantable = []Role{RoleOwner, RoleTrusted, RoleUser}
+
+func (r Role) String() string {
+	switch r {
+	case RoleOwner:
+		return "owner"
+	case RoleTrusted:
+		return "trusted"
+	case RoleUser:
+		return "user"
+	}
+	return "none"
+}
+
+// ParseRole parses the name of a role.
+func ParseRole(s string) (Role, error) {
+	for _, r := range grantable {
+		if strings.EqualFold(r.String(), s) {
+			return r, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q", s)
+}
+
+// Restricted is implemented by plugins that need more than RoleUser.
+type Restricted interface {
+	Role() Role
+}
+
+// Required returns the role needed to use p.
+func Required(p Plugin) Role {
+	if r, ok := p.(Restricted); ok {
+		return r.Role()
+	}
+	return RoleUser
+}
+
+// aclKey is the store key listing the members of r. Entries are either
+// "chat:id" (for example "matrix:@qbit:tapenet.org" or "sms:+15551234567")
+// or just "id", which matches on every chat.
+func aclKey(r Role) string {
+	return fmt.Sprintf("acl_%s", r)
+}
+
+func aclMatch(entry string, mc *MessageContext) bool {
+	if entry == mc.Sender || entry == mc.User {
+		return true
+	}
+	chat, id, ok := strings.Cut(entry, ":")
+	return ok && strings.EqualFold(chat, mc.Chat) && id == mc.Sender
+}
+
+// RoleOf returns the role of the sender of mc. Roles granted to the
+// canonical user (see Resolve) apply to all linked identities. People that
+// aren't listed are users, unless the chat is listed in "acl_restricted",
+// then they are ignored. Unverified senders (see MessageContext) are users
+// at most, anyone could claim to be them.
+func RoleOf(store PluginStore, mc *MessageContext) Role {
+	if mc.User == "" {
+		mc.User = Resolve(store, mc)
+	}
+
+	for _, r := range grantable {
+		if slices.ContainsFunc(List(store, aclKey(r)), func(e string) bool {
+			return aclMatch(e, mc)
+		}) {
+			if mc.Unverified && r > RoleUser {
+				return RoleUser
+			}
+			return r
+		}
+	}
+
+	if hasName(List(store, "acl_restricted"), mc.Chat) {
+		return RoleNone
+	}
+
+	return RoleUser
+}
+
+// Grant adds id (in "chat:id" or "id" form) to role r, removing it from
+// any other role.
+func Grant(store PluginStore, id string, r Role) error {
+	if err := Revoke(store, id); err != nil {
+		return err
+	}
+	return AddToSet(store, aclKey(r), id)
+}
+
+// Members returns the entries of role r.
+func Members(store PluginStore, r Role) []string {
+	return List(store, aclKey(r))
+}
+
+// Revoke removes id from all roles.
+func Revoke(store PluginStore, id string) error {
+	for _, r := range grantable {
+		if err := RemoveFromList(store, aclKey(r), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateACL moves the old "bot_owners", "matrix_bot_owner" and "sms_users"
+// settings into the ACL. Lists that already exist are left alone. It also
+// sets "relay_bots" to tapebot, the relay bot the IRC chat used to handle
+// itself, if relay_bots isn't set at all.
+func MigrateACL(store PluginStore) error {
+	missing := func(key string) bool {
+		_, err := store.Get(key)
+		return err != nil
+	}
+	set := func(key, value string) error {
+		if err := store.Set(key, value); err != nil {
+			return fmt.Errorf("ACL: can't migrate %q: %w", key, err)
+		}
+		return nil
+	}
+
+	if missing(aclKey(RoleOwner)) {
+		owners := List(store, "bot_owners")
+		if o, err := store.Get("matrix_bot_owner"); err == nil && o != "" {
+			owners = append(owners, "matrix:"+o)
+		}
+		if len(owners) > 0 {
+			log.Printf("ACL: migrating owners: %q", owners)
+			if err := set(aclKey(RoleOwner), strings.Join(owners, ",")); err != nil {
+				return err
+			}
+		}
+	}
+
+	// tapebot was unwrapped by the IRC chat before relay bots could be
+	// configured, keep doing so until relay_bots is set.
+	if missing("relay_bots") {
+		log.Printf("ACL: migrating the IRC relay bot tapebot to relay_bots")
+		if missing("relay_re_irc") {
+			if err := set("relay_re_irc", tapebotRelayRe); err != nil {
+				return err
+			}
+		}
+		if err := set("relay_bots", "irc:tapebot"); err != nil {
+			return err
+		}
+	}
+
+	smsUsers := List(store, "sms_users")
+	if len(smsUsers) == 0 {
+		return nil
+	}
+	// Restrict SMS first, so numbers that aren't users never get in.
+	if missing("acl_restricted") {
+		if err := set("acl_restricted", "sms"); err != nil {
+			return err
+		}
+	}
+	if missing(aclKey(RoleUser)) {
+		var users []string
+		for _, u := range smsUsers {
+			users = append(users, "sms:"+u)
+		}
+		log.Printf("ACL: migrating SMS users: %q", users)
+		if err := set(aclKey(RoleUser), strings.Join(users, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Roles lets owners grant and revoke roles from chat.
+type Roles struct {
+	db PluginStore
+}
+
+// Descr describes this plugin
+func (p *Roles) Descr() string {
+	return "Grant or revoke roles (`owner`, `trusted`, `user`). IDs can be limited to a chat with `chat:id`. Owners only."
+}
+
+// Re matches our role commands
+func (p *Roles) Re() string {
+	return `(?i)^roles: (?P<cmd>grant (?P<role>\w+)|revoke|show) ?(?P<id>\S*)$`
+}
+
+// Match checks for "roles: " messages
+func (p *Roles) Match(_ *MessageContext, msg string) bool {
+	return Compiled(p).MatchString(msg)
+}
+
+// Role restricts Roles to owners
+func (p *Roles) Role() Role {
+	return RoleOwner
+}
+
+// Privileged gives Roles the main store, it manages roles
+func (p *Roles) Privileged() bool {
+	return true
+}
+
+// SetStore sets the store
+func (p *Roles) SetStore(s PluginStore) {
+	p.db = s
+}
+
+// Process grants, revokes or shows roles
+func (p *Roles) Process(_ context.Context, mc *MessageContext, _ string, _ Emitter) *Response {
+	cmd, id := strings.ToLower(mc.Captures["cmd"]), mc.Captures["id"]
+
+	if cmd == "show" {
+		var s []string
+		for _, r := range grantable {
+			s = append(s, fmt.Sprintf("%s: %q", r, List(p.db, aclKey(r))))
+		}
+		return Text(strings.Join(s, ", "))
+	}
+
+	if id == "" {
+		return Errorf("sorry %s, I need someone to %s", mc.Name(), strings.Fields(cmd)[0])
+	}
+
+	if cmd == "revoke" {
+		if err := Revoke(p.db, id); err != nil {
+			return Error(err)
+		}
+		return Text(fmt.Sprintf("%s no longer has a role", id))
+	}
+
+	r, err := ParseRole(mc.Captures["role"])
+	if err != nil {
+		return Error(err)
+	}
+	if err := Grant(p.db, id, r); err != nil {
+		return Error(err)
+	}
+	return Text(fmt.Sprintf("%s is now %s", id, r))
+}
+
+// Name Roles
+func (p *Roles) Name() string {
+	return "Roles"
+}
@@ -0,0 +1,71 @@
+package plugins
+
+import (
+	"fmt"
+	"testing"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestRoleOf(t *testing.T) {
+	store := mcstoretest.Map{
+		"bot_owners":       "@qbit:tapenet.org",
+		"matrix_bot_owner": "@other:tapenet.org",
+		"sms_users":        "+15551234567",
+	}
+	if err := MigrateACL(store); err != nil {
+		t.Fatal(err)
+	}
+	Grant(store, "irc:friend", RoleTrusted)
+
+	testRoles := []struct {
+		mc   *MessageContext
+		role Role
+	}{
+		{&MessageContext{Chat: "Matrix", Sender: "@qbit:tapenet.org"}, RoleOwner},
+		{&MessageContext{Chat: "XMPP", Sender: "@qbit:tapenet.org"}, RoleOwner},
+		{&MessageContext{Chat: "Matrix", Sender: "@other:tapenet.org"}, RoleOwner},
+		{&MessageContext{Chat: "IRC", Sender: "@other:tapenet.org"}, RoleUser},
+		{&MessageContext{Chat: "IRC", Sender: "friend"}, RoleTrusted},
+		{&MessageContext{Chat: "XMPP", Sender: "friend"}, RoleUser},
+		{&MessageContext{Chat: "SMS", Sender: "+15551234567"}, RoleUser},
+		{&MessageContext{Chat: "SMS", Sender: "+15550000000"}, RoleNone},
+		{&MessageContext{Chat: "Mail", Sender: "@qbit:tapenet.org", Unverified: true}, RoleUser},
+		{&MessageContext{Chat: "SMS", Sender: "+15550000000", Unverified: true}, RoleNone},
+	}
+
+	for _, tr := range testRoles {
+		if r := RoleOf(store, tr.mc); r != tr.role {
+			t.Errorf("%s on %s: expected %s; got %s\n", tr.mc.Sender, tr.mc.Chat, tr.role, r)
+		}
+	}
+
+	if msg, ok := Unrelay(store, &MessageContext{Chat: "IRC", Sender: "tapebot"}, "tapebot <qbit> hi"); !ok || msg != "hi" {
+		t.Errorf("expected tapebot to be migrated to a relay bot; got %q (%t)\n", msg, ok)
+	}
+
+	Grant(store, "irc:friend", RoleOwner)
+	if store["acl_trusted"] != "" || store["acl_owner"] != "@qbit:tapenet.org,matrix:@other:tapenet.org,irc:friend" {
+		t.Errorf("unexpected ACL after grant: %q\n", store)
+	}
+
+	Revoke(store, "irc:friend")
+	if r := RoleOf(store, &MessageContext{Chat: "IRC", Sender: "friend"}); r != RoleUser {
+		t.Errorf("expected user after revoke; got %s\n", r)
+	}
+}
+
+type readOnlyStore struct {
+	mcstoretest.Map
+}
+
+func (s readOnlyStore) Set(key, _ string) error {
+	return fmt.Errorf("can't write %q", key)
+}
+
+func TestMigrateACLFails(t *testing.T) {
+	store := readOnlyStore{mcstoretest.Map{"sms_users": "+15551234567", "relay_bots": ""}}
+	if err := MigrateACL(store); err == nil {
+		t.Errorf("expected the SMS restriction failing to be written to be an error\n")
+	}
+}
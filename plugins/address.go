@@ -0,0 +1,108 @@
+package plugins
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Nick returns the name people use to talk to the bot on mc.Chat: BotNick
+// if the chat set one, otherwise BotName without the decorations of Matrix
+// IDs ("@name:server") and JIDs ("name@server/resource").
+func (mc *MessageContext) Nick() string {
+	if mc.BotNick != "" {
+		return mc.BotNick
+	}
+	name := NameRE.ReplaceAllString(mc.BotName, "$1")
+	if n, _, ok := strings.Cut(name, "@"); ok && n != "" {
+		return n
+	}
+	return name
+}
+
+// names returns the names the bot goes by on mc.Chat.
+func (mc *MessageContext) names() []string {
+	var names []string
+	for _, n := range []string{mc.Nick(), mc.BotName} {
+		if n != "" && !hasName(names, n) {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// Mentions reports whether msg mentions the bot by name. Like ToMe, when
+// we don't know the bot's name every message counts.
+func (mc *MessageContext) Mentions(msg string) bool {
+	names := mc.names()
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		re := mustCompile(`(?i)(^|\W)` + regexp.QuoteMeta(n) + `($|\W)`)
+		if re.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToMe reports whether msg is meant for the bot, either because it was
+// addressed to it (see Address) or mentions it.
+func (mc *MessageContext) ToMe(msg string) bool {
+	return mc.Addressed || mc.Mentions(msg)
+}
+
+// setting returns key for chat ("key_chat"), falling back to key.
+func setting(store PluginStore, key, chat string) string {
+	if v, _ := store.Get(key + "_" + strings.ToLower(chat)); v != "" {
+		return v
+	}
+	v, _ := store.Get(key)
+	return v
+}
+
+// Address works out whether msg is meant for the bot and sets
+// mc.Addressed. Messages are addressed to the bot when they are sent
+// directly, start with the command prefix ("command_prefix") or start with
+// the bot's name followed by ":" or ",". The prefix or name is removed
+// from the returned message, "!weather 12345" becomes "weather: 12345".
+//
+// Chats that don't know the bot by name (Signal, SMS...) can be given one
+// with "bot_nick". Setting "passive" to "off" makes the bot ignore
+// everything that isn't addressed to it or mentions it, in which case
+// Address returns false. All settings can be set per chat by adding the
+// chat's name: "command_prefix_irc".
+func Address(store PluginStore, mc *MessageContext, msg string) (string, bool) {
+	mc.Addressed = mc.Direct
+	if mc.BotNick == "" {
+		mc.BotNick = setting(store, "bot_nick", mc.Chat)
+	}
+
+	if prefix := setting(store, "command_prefix", mc.Chat); prefix != "" {
+		if cmd, ok := strings.CutPrefix(msg, prefix); ok && cmd != "" {
+			mc.Addressed = true
+			name, args, _ := strings.Cut(cmd, " ")
+			if !strings.HasSuffix(name, ":") {
+				name += ":"
+			}
+			return strings.TrimSpace(name + " " + args), true
+		}
+	}
+
+	// Longer names first, so "@name:server: " isn't taken for "name: ".
+	names := mc.names()
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for _, n := range names {
+		re := mustCompile(`(?i)^@?` + regexp.QuoteMeta(strings.TrimPrefix(n, "@")) + `[:,]\s*(\S.*)$`)
+		if m := re.FindStringSubmatch(msg); m != nil {
+			mc.Addressed = true
+			return m[1], true
+		}
+	}
+
+	if !mc.ToMe(msg) && setting(store, "passive", mc.Chat) == "off" {
+		return msg, false
+	}
+	return msg, true
+}
@@ -0,0 +1,54 @@
+package plugins
+
+import (
+	"testing"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestNick(t *testing.T) {
+	testNicks := []struct {
+		mc   *MessageContext
+		nick string
+	}{
+		{&MessageContext{BotName: "@mcchunkie:tapenet.org"}, "mcchunkie"},
+		{&MessageContext{BotName: "mcchunkie@tapenet.org/bot"}, "mcchunkie"},
+		{&MessageContext{BotName: "mcchunkie_", BotNick: "mcchunkie_"}, "mcchunkie_"},
+		{&MessageContext{BotName: "+15551234567", BotNick: "chunk"}, "chunk"},
+	}
+
+	for _, tn := range testNicks {
+		if n := tn.mc.Nick(); n != tn.nick {
+			t.Errorf("%q: expected %q; got %q\n", tn.mc.BotName, tn.nick, n)
+		}
+	}
+}
+
+func TestAddress(t *testing.T) {
+	store := mcstoretest.Map{"command_prefix": "!", "passive_matrix": "off"}
+	testMsgs := []struct {
+		chat, msg, want string
+		addressed, ok   bool
+	}{
+		{"IRC", "weather: 12345", "weather: 12345", false, true},
+		{"IRC", "!weather 12345", "weather: 12345", true, true},
+		{"IRC", "!weather: 12345", "weather: 12345", true, true},
+		{"IRC", "mcchunkie: weather: 12345", "weather: 12345", true, true},
+		{"IRC", "McChunkie, version", "version", true, true},
+		{"IRC", "mcchunkies: version", "mcchunkies: version", false, true},
+		{"Matrix", "weather: 12345", "weather: 12345", false, false},
+		{"Matrix", "@mcchunkie:tapenet.org: version", "version", true, true},
+		{"Matrix", "botsnack mcchunkie", "botsnack mcchunkie", false, true},
+	}
+
+	for _, tm := range testMsgs {
+		mc := &MessageContext{Chat: tm.chat, BotName: "mcchunkie"}
+		if tm.chat == "Matrix" {
+			mc.BotName = "@mcchunkie:tapenet.org"
+		}
+		msg, ok := Address(store, mc, tm.msg)
+		if msg != tm.want || mc.Addressed != tm.addressed || ok != tm.ok {
+			t.Errorf("%s %q: expected %q (%t, %t); got %q (%t, %t)\n", tm.chat, tm.msg, tm.want, tm.addressed, tm.ok, msg, mc.Addressed, ok)
+		}
+	}
+}
@@ -1,12 +1,10 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Ban responds to ban messages
@@ -24,39 +22,33 @@ func (h *Ban) Re() string {
 }
 
 // Match determines if we should execute Ban
-func (h *Ban) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Ban) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
+// Role restricts Ban to owners
+func (h *Ban) Role() Role {
+	return RoleOwner
+}
+
 // SetStore we don't need a store, so just return
 func (h *Ban) SetStore(_ PluginStore) {}
 
 // Process does the heavy lifting
-func (h *Ban) Process(from, msg string) string {
-	return ""
-}
-
-// RespondText to botsnack events
-func (h *Ban) RespondText(c *gomatrix.Client, ev *gomatrix.Event, user, post string) error {
-	switch ev.Sender {
-	case "@qbit:tapenet.org":
-		speed := 5
-		re := regexp.MustCompile(h.Re())
-		cmd := re.ReplaceAllString(post, "$1")
-		bans := strings.Split(re.ReplaceAllString(post, "$2"), " ")
-
-		go func() {
-			SendText(c, ev.RoomID, fmt.Sprintf("Banning %d %s with %d seconds inbetween bans.", len(bans), cmd, speed))
-			for _, ban := range bans {
-				st := fmt.Sprintf("hammer ban ob %s %s spam", cmd, ban)
-				SendText(c, ev.RoomID, st)
-				time.Sleep(time.Second * time.Duration(speed))
-			}
-			SendText(c, ev.RoomID, "Done banning.")
-		}()
+func (h *Ban) Process(_ context.Context, _ *MessageContext, post string, emit Emitter) *Response {
+	speed := 5
+	re := Compiled(h)
+	cmd := re.ReplaceAllString(post, "$1")
+	bans := strings.Split(re.ReplaceAllString(post, "$2"), " ")
+
+	var cmds []string
+	for _, ban := range bans {
+		cmds = append(cmds, fmt.Sprintf("hammer ban ob %s %s spam", cmd, ban))
 	}
-	return nil
+
+	emit.After(time.Second*time.Duration(speed), Text(strings.Join(append(cmds, "Done banning."), "\n")))
+	return Text(fmt.Sprintf("Banning %d %s in %d seconds.", len(bans), cmd, speed))
 }
 
 // Name Ban
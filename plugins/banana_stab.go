@@ -1,10 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 type BananaStab struct {
@@ -21,34 +19,28 @@ func (h *BananaStab) Re() string {
 }
 
 func (h *BananaStab) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	stabee := re.ReplaceAllString(msg, "$1")
 	return stabee
 }
 
 // Match checks for our stabee person
-func (h *BananaStab) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *BananaStab) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
 // SetStore does nothing in BananaStab
 func (h *BananaStab) SetStore(_ PluginStore) {}
 
-func (h *BananaStab) Process(from, post string) (string, func() string) {
+func (h *BananaStab) Process(_ context.Context, _ *MessageContext, post string, _ Emitter) *Response {
 	stabee := h.fix(post)
 	stabtxt := "..."
 	if stabee != "" {
 		stabtxt = fmt.Sprintf("stabs %s with the fury of a thousand radioactive bananas", stabee)
 	}
 	//jsonmsg := "{ \"body\": \"" + stabtxt + "\", \"type\": \"m.emote\"}"
-	return stabtxt, RespStub
-}
-
-// RespondText stabs an unsuspecting person
-func (h *BananaStab) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendEmote(c, ev.RoomID, resp)
+	return Emote(stabtxt)
 }
 
 // Name BananaStab!
@@ -1,11 +1,9 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
 	"time"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Beat responds to beat messages
@@ -23,27 +21,21 @@ func (h *Beat) Re() string {
 }
 
 // Match determines if we are asking for a beat
-func (h *Beat) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Beat) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
 // SetStore we don't need a store here
 func (h *Beat) SetStore(_ PluginStore) {}
 
-// RespondText to beat request events
-func (h *Beat) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, _ string) error {
-	resp, _ := h.Process("", "")
-	return SendText(c, ev.RoomID, resp)
-}
-
 // Process does the heavy lifting of calculating .beat
-func (h *Beat) Process(from, msg string) (string, func() string) {
+func (h *Beat) Process(_ context.Context, _ *MessageContext, msg string, _ Emitter) *Response {
 	n := time.Now()
 	utc1 := n.Unix() + 3600
 	r := utc1 % 86400
 	bt := float32(r) / 86.4
-	return fmt.Sprintf("@%03d", int32(bt)), RespStub
+	return Text(fmt.Sprintf("@%03d", int32(bt)))
 }
 
 // Name beat
@@ -15,7 +15,7 @@ func TestBeatMatch(t *testing.T) {
 
 	b := &Beat{}
 	for msg, should := range testStrings {
-		if b.Match("", msg) != should {
+		if b.Match(&MessageContext{}, msg) != should {
 			t.Errorf("Beat expected to match %q (%t); but doesn't\n", msg, should)
 		}
 	}
@@ -1,13 +1,10 @@
 package plugins
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"net/url"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Beer responds to beer requests
@@ -63,13 +60,13 @@ func (h *Beer) Re() string {
 }
 
 func (h *Beer) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	return re.ReplaceAllString(msg, "$1")
 }
 
 // Match determines if we should call the response for Beer
-func (h *Beer) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Beer) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
@@ -89,12 +86,17 @@ func (h *Beer) pretty(d BeerData) string {
 	)
 }
 
-// SetStore we don't need a store here.
+// Settings lets Beer read the API key
+func (h *Beer) Settings() []string {
+	return []string{"beer_api_key"}
+}
+
+// SetStore sets the store
 func (h *Beer) SetStore(s PluginStore) {
 	h.store = s
 }
 
-func (h *Beer) Process(from, msg string) (string, func() string) {
+func (h *Beer) Process(ctx context.Context, mc *MessageContext, msg string, _ Emitter) *Response {
 	key, _ := h.store.Get("beer_api_key")
 	beer := h.fix(msg)
 	resp := "¯\\_(ツ)_/¯"
@@ -104,8 +106,9 @@ func (h *Beer) Process(from, msg string) (string, func() string) {
 			url.PathEscape(beer),
 		)
 		req := HTTPRequest{
-			Method: "GET",
-			URL:    u,
+			Context: ctx,
+			Method:  "GET",
+			URL:     u,
 			Headers: map[string]string{
 				"x-rapidapi-key":  key,
 				"x-rapidapi-host": "beer9.p.rapidapi.com",
@@ -114,35 +117,31 @@ func (h *Beer) Process(from, msg string) (string, func() string) {
 
 		data, err := req.Do()
 		if err != nil {
-			return fmt.Sprintf("sorry %s, I can't look for beer. (%s)", from, err), RespStub
+			return Errorf("sorry %s, I can't look for beer. (%s)", mc.Name(), err)
 		}
 
 		var singleBeer BeerResp
 		var multipleBeer BeerResps
 		err = json.Unmarshal(data, &multipleBeer)
 		if err == nil && len(multipleBeer.Data) > 0 {
-			l := len(multipleBeer.Data)
-			rb := multipleBeer.Data[rand.Intn(l)]
-			return fmt.Sprintf("Found %d results, here's a random one: %s", l, h.pretty(rb)), RespStub
+			var beers []string
+			for _, b := range multipleBeer.Data {
+				beers = append(beers, h.pretty(b))
+			}
+			return Results(fmt.Sprintf("Found %d results:", len(beers)), beers)
 		}
 		err = json.Unmarshal(data, &singleBeer)
 		if err != nil {
-			return fmt.Sprintf("sorry %s, I can't look for beer. (%s)", from, err), RespStub
+			return Errorf("sorry %s, I can't look for beer. (%s)", mc.Name(), err)
 		}
 
 		if singleBeer.Code == 200 {
-			return h.pretty(singleBeer.Data), RespStub
+			return Text(h.pretty(singleBeer.Data))
 		}
 
-		return fmt.Sprintf("Sorry that beer is %d", singleBeer.Code), RespStub
+		return Text(fmt.Sprintf("Sorry that beer is %d", singleBeer.Code))
 	}
-	return resp, RespStub
-}
-
-// RespondText to looking up of beer requests
-func (h *Beer) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendText(c, ev.RoomID, resp)
+	return Text(resp)
 }
 
 // Name Beer!
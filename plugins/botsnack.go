@@ -1,10 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"math/rand"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // BotSnack responds to botsnack messages
@@ -22,8 +20,8 @@ func (h *BotSnack) Re() string {
 }
 
 // Match determines if we should execute BotSnack
-func (h *BotSnack) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *BotSnack) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
@@ -31,9 +29,8 @@ func (h *BotSnack) Match(_, msg string) bool {
 func (h *BotSnack) SetStore(_ PluginStore) {}
 
 // Process does the heavy lifting
-func (h *BotSnack) Process(from, msg string) (string, func() string) {
-	u := NameRE.ReplaceAllString(from, "$1")
-	if ToMe(u, msg) {
+func (h *BotSnack) Process(_ context.Context, mc *MessageContext, msg string, _ Emitter) *Response {
+	if mc.ToMe(msg) {
 		a := []string{
 			"omm nom nom nom",
 			"*puke*",
@@ -41,15 +38,9 @@ func (h *BotSnack) Process(from, msg string) (string, func() string) {
 			"=.=",
 		}
 
-		return a[rand.Intn(len(a))], RespStub
+		return Text(a[rand.Intn(len(a))])
 	}
-	return "", RespStub
-}
-
-// RespondText to botsnack events
-func (h *BotSnack) RespondText(c *gomatrix.Client, ev *gomatrix.Event, user, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendText(c, ev.RoomID, resp)
+	return nil
 }
 
 // Name BotSnack
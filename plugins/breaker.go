@@ -0,0 +1,168 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakerThreshold is the number of failures in a row that
+	// disable a plugin, it can be changed with "breaker_threshold".
+	DefaultBreakerThreshold = 3
+	// DefaultBreakerCooldown is how long a plugin stays disabled, it can
+	// be changed with "breaker_cooldown".
+	DefaultBreakerCooldown = 10 * time.Minute
+)
+
+// BreakerState is what a Breaker knows about a single plugin.
+type BreakerState struct {
+	Failures  int
+	LastError string
+	OpenUntil time.Time
+}
+
+// Breaker is a circuit breaker for plugins. Plugins that fail (panic or
+// time out) Threshold times in a row are disabled for Cooldown. After the
+// cool-down they get one more chance, failing again disables them right
+// away.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu    sync.Mutex
+	state map[string]*BreakerState
+}
+
+// NewBreaker creates a Breaker.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		state:     map[string]*BreakerState{},
+	}
+}
+
+// Allow reports whether the plugin called name may run.
+func (b *Breaker) Allow(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.state[name]
+	return !ok || time.Now().After(s.OpenUntil)
+}
+
+// Success resets the failures of name.
+func (b *Breaker) Success(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.state, name)
+}
+
+// Failure records a failure of name. It returns true if this failure
+// disabled the plugin.
+func (b *Breaker) Failure(name string, err error) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.state[name]
+	if !ok {
+		s = &BreakerState{}
+		b.state[name] = s
+	}
+	s.Failures++
+	s.LastError = err.Error()
+
+	if s.Failures >= b.Threshold {
+		s.OpenUntil = time.Now().Add(b.Cooldown)
+		return true
+	}
+	return false
+}
+
+// State returns a copy of the state of all plugins that have failed.
+func (b *Breaker) State() map[string]BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := map[string]BreakerState{}
+	for name, s := range b.state {
+		state[name] = *s
+	}
+	return state
+}
+
+// BreakerUser is implemented by plugins that want to know about the
+// dispatcher's Breaker.
+type BreakerUser interface {
+	SetBreaker(b *Breaker)
+}
+
+// Status shows which plugins have been failing.
+type Status struct {
+	breaker *Breaker
+}
+
+// Descr describes this plugin
+func (s *Status) Descr() string {
+	return "Show plugins that have been failing or are disabled. Owners only."
+}
+
+// Re matches status
+func (s *Status) Re() string {
+	return `(?i)^status:$`
+}
+
+// Match checks for "status:"
+func (s *Status) Match(_ *MessageContext, msg string) bool {
+	return Compiled(s).MatchString(msg)
+}
+
+// Role restricts Status to owners
+func (s *Status) Role() Role {
+	return RoleOwner
+}
+
+// SetStore we don't need a store here
+func (s *Status) SetStore(_ PluginStore) {}
+
+// SetBreaker sets the breaker we report on
+func (s *Status) SetBreaker(b *Breaker) {
+	s.breaker = b
+}
+
+// Process lists the failing plugins
+func (s *Status) Process(_ context.Context, _ *MessageContext, _ string, _ Emitter) *Response {
+	if s.breaker == nil {
+		return Text("no breaker, all plugins are running")
+	}
+
+	state := s.breaker.State()
+	if len(state) == 0 {
+		return Text("all plugins are healthy")
+	}
+
+	var names []string
+	for name := range state {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		st := state[name]
+		status := "failing"
+		if time.Now().Before(st.OpenUntil) {
+			status = fmt.Sprintf("disabled until %s", st.OpenUntil.Format(time.RFC1123))
+		}
+		lines = append(lines, fmt.Sprintf("- **%s**: %s, %d failures, last: `%s`", name, status, st.Failures, st.LastError))
+	}
+	return Markdown(strings.Join(lines, "\n"))
+}
+
+// Name Status
+func (s *Status) Name() string {
+	return "Status"
+}
@@ -0,0 +1,68 @@
+package plugins
+
+// MessageContext describes where a message came from and who sent it. Chats
+// fill this in so plugins can make the same decisions on every network.
+type MessageContext struct {
+	// Chat is the name of the chat the message arrived on ("Matrix",
+	// "IRC", ...).
+	Chat string `json:"chat"`
+
+	// Room is where replies go: a Matrix room ID, IRC channel, Signal
+	// group ID... For direct messages this is the sender.
+	Room string `json:"room"`
+
+	// Sender is the normalized identity of the sender: a Matrix ID, IRC
+	// nick, bare XMPP JID, Signal UUID, email address or phone number.
+	Sender string `json:"sender"`
+
+	// User is the canonical user ID of the sender. Identities linked
+	// across chats (see Linker) share the same User.
+	User string `json:"user"`
+
+	// RelayedBy is the relay bot that passed on the message, if any. See
+	// Unrelay.
+	RelayedBy string `json:"relayed_by,omitempty"`
+
+	// Unverified is true when the chat can't vouch for Sender, like the
+	// From of an email. Unverified senders are never more than users, see
+	// RoleOf.
+	Unverified bool `json:"unverified,omitempty"`
+
+	// DisplayName is a friendly name for the sender.
+	DisplayName string `json:"display_name"`
+
+	// Direct is true when the message was sent directly to the bot rather
+	// than in a group.
+	Direct bool `json:"direct"`
+
+	// BotName is the bot's own identity on this chat.
+	BotName string `json:"bot_name"`
+
+	// BotNick is the name people use to mention the bot, if it differs
+	// from BotName. See Nick.
+	BotNick string `json:"bot_nick,omitempty"`
+
+	// Addressed is true when the message was meant for the bot, see
+	// Address.
+	Addressed bool `json:"addressed"`
+
+	// MessageID identifies the message on the chat, if the chat has such
+	// a thing.
+	MessageID string `json:"message_id"`
+
+	// Edits is true when the chat can edit messages the bot sent, see
+	// Emitter.
+	Edits bool `json:"edits"`
+
+	// Captures holds the named capture groups of the matching plugin's
+	// regular expression.
+	Captures map[string]string `json:"captures,omitempty"`
+}
+
+// Name returns the friendliest name we have for the sender.
+func (mc *MessageContext) Name() string {
+	if mc.DisplayName != "" {
+		return mc.DisplayName
+	}
+	return mc.Sender
+}
@@ -0,0 +1,408 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxCommandBody is the most we read from the URL of a command.
+const maxCommandBody = 1 << 20
+
+// Command is a command defined at runtime (see Custom). A command needs a
+// regular expression and at least one of Text, Choices or URL.
+type Command struct {
+	// Re is the regular expression that triggers the command.
+	Re string `json:"re"`
+	// Text is the response. $1, ${name}... are replaced by the capture
+	// groups of Re, $sender by the sender, $choice by one of Choices
+	// and $result by what was found at URL. Without Text the response is
+	// $choice or $result.
+	Text string `json:"text,omitempty"`
+	// Choices are picked from at random. They can use capture groups and
+	// $sender too.
+	Choices []string `json:"choices,omitempty"`
+	// URL is fetched (with GET) and the JSON it returns is searched for
+	// Path, which becomes $result. Capture groups are query escaped.
+	URL string `json:"url,omitempty"`
+	// Path is a dot separated path in the JSON of URL, "list.0.name".
+	Path string `json:"path,omitempty"`
+	// Descr describes the command.
+	Descr string `json:"descr,omitempty"`
+}
+
+// commandFields are the fields that can be set from chat.
+var commandFields = []string{"re", "text", "choices", "url", "path", "descr"}
+
+func (c *Command) set(field, value string) error {
+	switch field {
+	case "re":
+		if _, err := regexp.Compile(value); err != nil {
+			return err
+		}
+		c.Re = value
+	case "text":
+		c.Text = value
+	case "choices":
+		c.Choices = nil
+		for _, ch := range strings.Split(value, "|") {
+			if ch = strings.TrimSpace(ch); ch != "" {
+				c.Choices = append(c.Choices, ch)
+			}
+		}
+	case "url":
+		if value != "" {
+			if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("invalid url %q", value)
+			}
+		}
+		c.URL = value
+	case "path":
+		c.Path = value
+	case "descr":
+		c.Descr = value
+	default:
+		return fmt.Errorf("unknown field %q, use one of %s", field, strings.Join(commandFields, ", "))
+	}
+	return nil
+}
+
+// Valid returns an error if c can't be used yet.
+func (c *Command) Valid() error {
+	if c.Re == "" {
+		return fmt.Errorf("no re")
+	}
+	if c.Text == "" && len(c.Choices) == 0 && c.URL == "" {
+		return fmt.Errorf("no text, choices or url")
+	}
+	return nil
+}
+
+// expand replaces the variables in s with vals, escaped with esc.
+func expand(s string, vals map[string]string, esc func(string) string) string {
+	return os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return esc(vals[name])
+	})
+}
+
+// lookup finds path in the decoded JSON v.
+func lookup(v any, path string) (string, error) {
+	if path != "" {
+		for _, p := range strings.Split(path, ".") {
+			switch n := v.(type) {
+			case map[string]any:
+				var ok bool
+				if v, ok = n[p]; !ok {
+					return "", fmt.Errorf("no %q in %q", p, path)
+				}
+			case []any:
+				i, err := strconv.Atoi(p)
+				if err != nil || i < 0 || i >= len(n) {
+					return "", fmt.Errorf("no %q in %q", p, path)
+				}
+				v = n[i]
+			default:
+				return "", fmt.Errorf("no %q in %q", p, path)
+			}
+		}
+	}
+
+	switch r := v.(type) {
+	case string:
+		return r, nil
+	case nil:
+		return "", nil
+	case map[string]any, []any:
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		err := enc.Encode(r)
+		return strings.TrimSpace(b.String()), err
+	}
+	return fmt.Sprint(v), nil
+}
+
+// fetch gets u and looks up path in the JSON it returns.
+func fetch(ctx context.Context, u, path string) (string, error) {
+	resp, err := httpGet(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+
+	var v any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxCommandBody)).Decode(&v); err != nil {
+		return "", err
+	}
+	return lookup(v, path)
+}
+
+// Run produces the response of c to msg, which matched re.
+func (c *Command) Run(ctx context.Context, mc *MessageContext, re *regexp.Regexp, msg string) (string, error) {
+	vals := map[string]string{"sender": mc.Name()}
+	if m := re.FindStringSubmatch(msg); m != nil {
+		for i, name := range re.SubexpNames() {
+			vals[strconv.Itoa(i)] = m[i]
+			if name != "" {
+				vals[name] = m[i]
+			}
+		}
+	}
+	same := func(s string) string { return s }
+
+	if len(c.Choices) > 0 {
+		vals["choice"] = expand(c.Choices[rand.Intn(len(c.Choices))], vals, same)
+	}
+
+	if c.URL != "" {
+		res, err := fetch(ctx, expand(c.URL, vals, url.QueryEscape), c.Path)
+		if err != nil {
+			return "", err
+		}
+		vals["result"] = res
+	}
+
+	text := c.Text
+	switch {
+	case text != "":
+	case c.URL != "":
+		text = "$result"
+	default:
+		text = "$choice"
+	}
+	return expand(text, vals, same), nil
+}
+
+// commandKey is the store key of the command name. "commands" lists the
+// names of all commands.
+func commandKey(name string) string {
+	return fmt.Sprintf("command_%s", strings.ToLower(name))
+}
+
+// compiledCommand is a command with its regular expression compiled, raw is
+// what it was loaded from.
+type compiledCommand struct {
+	raw string
+	cmd *Command
+	re  *regexp.Regexp
+}
+
+// Custom runs commands defined by the bot owners from chat, they are kept
+// in the store. "command: set <name> <field> <value>" sets a field of a
+// command, creating it if needed. Fields are re, text, choices (separated
+// by "|"), url, path and descr. "command: unset <name> <field>" clears a
+// field, "command: del <name>" removes a command. "command: show" lists
+// the commands, "command: show <name>" shows one.
+type Custom struct {
+	db PluginStore
+
+	mu    sync.Mutex
+	cache map[string]*compiledCommand
+}
+
+// Descr describes this plugin
+func (c *Custom) Descr() string {
+	return "Commands defined from chat with `command: set <name> <re|text|choices|url|path|descr> <value>`, `command: unset <name> <field>`, `command: del <name>` and `command: show [name]`. Managing them is for owners only."
+}
+
+// Re matches our management commands
+func (c *Custom) Re() string {
+	return `(?i)^command: (?P<cmd>set|unset|del|show)(?: (?P<name>\w+))?(?: (?P<field>\w+))?(?: (?P<value>.+))?$`
+}
+
+// Privileged gives Custom the main store, it keeps the commands there and
+// checks roles
+func (c *Custom) Privileged() bool {
+	return true
+}
+
+// SetStore sets the store
+func (c *Custom) SetStore(s PluginStore) {
+	c.db = s
+}
+
+// command returns the command name, nil if it doesn't exist or is broken.
+func (c *Custom) command(name string) *compiledCommand {
+	raw, err := c.db.Get(commandKey(name))
+	if err != nil || raw == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil {
+		c.cache = map[string]*compiledCommand{}
+	}
+	if cc, ok := c.cache[name]; ok && cc.raw == raw {
+		if cc.cmd == nil {
+			return nil
+		}
+		return cc
+	}
+
+	cc := &compiledCommand{raw: raw, cmd: &Command{}}
+	if err := json.Unmarshal([]byte(raw), cc.cmd); err != nil {
+		cc.cmd = nil
+	} else if cc.cmd.Valid() != nil {
+		cc.cmd = nil
+	} else if cc.re, err = regexp.Compile(cc.cmd.Re); err != nil {
+		cc.cmd = nil
+	}
+	c.cache[name] = cc
+	if cc.cmd == nil {
+		return nil
+	}
+	return cc
+}
+
+// find returns the first command matching msg.
+func (c *Custom) find(msg string) *compiledCommand {
+	for _, name := range List(c.db, "commands") {
+		if cc := c.command(name); cc != nil && cc.re.MatchString(msg) {
+			return cc
+		}
+	}
+	return nil
+}
+
+// Match checks for our management commands and the defined commands
+func (c *Custom) Match(_ *MessageContext, msg string) bool {
+	return Compiled(c).MatchString(msg) || c.find(msg) != nil
+}
+
+// load returns the definition of name, which may not be complete yet.
+func (c *Custom) load(name string) (*Command, error) {
+	cmd := &Command{}
+	if !Has(c.db, commandKey(name)) {
+		return cmd, nil
+	}
+	return cmd, GetJSON(c.db, commandKey(name), cmd)
+}
+
+func (c *Custom) save(name string, cmd *Command) error {
+	if err := SetJSON(c.db, commandKey(name), cmd); err != nil {
+		return err
+	}
+	return AddToSet(c.db, "commands", strings.ToLower(name))
+}
+
+func (c *Custom) show(name string) *Response {
+	if name == "" {
+		var s []string
+		for _, n := range List(c.db, "commands") {
+			cmd, err := c.load(n)
+			switch {
+			case err != nil:
+				s = append(s, fmt.Sprintf("- **%s**: broken, %s", n, err))
+			case cmd.Valid() != nil:
+				s = append(s, fmt.Sprintf("- **%s**: incomplete, %s", n, cmd.Valid()))
+			default:
+				s = append(s, fmt.Sprintf("- **%s**: `%s` %s", n, cmd.Re, cmd.Descr))
+			}
+		}
+		if len(s) == 0 {
+			return Text("no commands defined")
+		}
+		return Results("", s)
+	}
+
+	if !hasName(List(c.db, "commands"), name) {
+		return Errorf("no command %q", name)
+	}
+	cmd, err := c.load(name)
+	if err != nil {
+		return Error(err)
+	}
+	b, err := json.MarshalIndent(cmd, "", "  ")
+	if err != nil {
+		return Error(err)
+	}
+	return Markdown(fmt.Sprintf("```\n%s\n```", b))
+}
+
+// manage changes or shows the commands
+func (c *Custom) manage(mc *MessageContext) *Response {
+	op := strings.ToLower(mc.Captures["cmd"])
+	name := strings.ToLower(mc.Captures["name"])
+	field := strings.ToLower(mc.Captures["field"])
+
+	if RoleOf(c.db, mc) < RoleOwner {
+		return Errorf("sorry, %s, I can't let you do that.", mc.Name())
+	}
+	if op == "show" {
+		return c.show(name)
+	}
+	if name == "" {
+		return Errorf("sorry %s, which command?", mc.Name())
+	}
+
+	if op == "del" {
+		if err := c.db.Set(commandKey(name), ""); err != nil {
+			return Error(err)
+		}
+		if err := RemoveFromList(c.db, "commands", name); err != nil {
+			return Error(err)
+		}
+		return Text(fmt.Sprintf("removed %s", name))
+	}
+
+	cmd, err := c.load(name)
+	if err != nil {
+		return Error(err)
+	}
+	value := mc.Captures["value"]
+	if op == "unset" {
+		value = ""
+	} else if field == "" || value == "" {
+		return Errorf("sorry %s, I need a field (%s) and a value", mc.Name(), strings.Join(commandFields, ", "))
+	}
+	if err := cmd.set(field, value); err != nil {
+		return Error(err)
+	}
+	if err := c.save(name, cmd); err != nil {
+		return Error(err)
+	}
+
+	if err := cmd.Valid(); err != nil {
+		return Text(fmt.Sprintf("updated %s, it needs more before it can be used: %s", name, err))
+	}
+	return Text(fmt.Sprintf("updated %s", name))
+}
+
+// Process manages or runs the commands
+func (c *Custom) Process(ctx context.Context, mc *MessageContext, msg string, _ Emitter) *Response {
+	if Compiled(c).MatchString(msg) {
+		return c.manage(mc)
+	}
+
+	cc := c.find(msg)
+	if cc == nil {
+		return nil
+	}
+	text, err := cc.cmd.Run(ctx, mc, cc.re, msg)
+	if err != nil {
+		return Errorf("sorry %s, I can't do that right now (%s)", mc.Name(), err)
+	}
+	return Text(text)
+}
+
+// Name Custom
+func (c *Custom) Name() string {
+	return "Custom"
+}
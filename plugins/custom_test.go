@@ -0,0 +1,64 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestCustom(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"results": [{"name": %q, "count": 3}]}`, r.URL.Query().Get("q"))
+	}))
+	defer srv.Close()
+
+	store := mcstoretest.Map{"acl_owner": "qbit"}
+	c := &Custom{}
+	c.SetStore(store)
+	if _, err := Compile(c); err != nil {
+		t.Fatal(err)
+	}
+
+	testMsgs := []struct {
+		sender, msg, want string
+	}{
+		{"qbit", "command: show", "no commands defined"},
+		{"other", "command: set ping re ^ping$", "sorry, other, I can't let you do that."},
+		{"qbit", "command: set ping re ^ping$", "updated ping, it needs more before it can be used: no text, choices or url"},
+		{"qbit", "ping", ""},
+		{"qbit", "command: set ping text pong $sender", "updated ping"},
+		{"other", "ping", "pong other"},
+		{"qbit", "command: set ping re ((", "error parsing regexp: missing closing ): `((`"},
+		{"qbit", "command: set ddg re ^ddg (?P<q>.+)$", "updated ddg, it needs more before it can be used: no text, choices or url"},
+		{"qbit", "command: set ddg url " + srv.URL + "/?q=${q}", "updated ddg"},
+		{"other", "ddg a&b", `{"results":[{"count":3,"name":"a&b"}]}`},
+		{"qbit", "command: set ddg path results.0.name", "updated ddg"},
+		{"qbit", "command: set ddg text $$ $result", "updated ddg"},
+		{"other", "ddg a&b", "$ a&b"},
+		{"qbit", "command: set ddg path results.1.name", "updated ddg"},
+		{"other", "ddg a&b", `sorry other, I can't do that right now (no "1" in "results.1.name")`},
+		{"qbit", "command: set flip re ^flip (\\w+)$", "updated flip, it needs more before it can be used: no text, choices or url"},
+		{"qbit", "command: set flip choices $1 |  $1 ", "updated flip"},
+		{"other", "flip coin", "coin"},
+		{"qbit", "command: unset flip choices", "updated flip, it needs more before it can be used: no text, choices or url"},
+		{"other", "flip coin", ""},
+		{"qbit", "command: del flip", "removed flip"},
+		{"qbit", "command: show", "- **ping**: `^ping$` \n- **ddg**: `^ddg (?P<q>.+)$` "},
+	}
+
+	for _, tm := range testMsgs {
+		mc := &MessageContext{Chat: "IRC", Sender: tm.sender}
+		var got string
+		if c.Match(mc, tm.msg) {
+			mc.Captures = Captures(Compiled(c), tm.msg)
+			got = c.Process(context.Background(), mc, tm.msg, Discard).String()
+		}
+		if got != tm.want {
+			t.Errorf("%s %q: expected %q; got %q\n", tm.sender, tm.msg, tm.want, got)
+		}
+	}
+}
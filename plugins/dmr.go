@@ -1,13 +1,11 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"net/url"
-	"regexp"
 	"strings"
 	"time"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // DMRUser represents a response from:
@@ -66,27 +64,27 @@ func (p *DMR) Re() string {
 }
 
 // Match checks for "dmr " messages
-func (p *DMR) Match(_, msg string) bool {
-	re := regexp.MustCompile(p.Re())
+func (p *DMR) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(p)
 	return re.MatchString(msg)
 }
 
 func (p *DMR) param(msg string) string {
-	re := regexp.MustCompile(p.Re())
+	re := Compiled(p)
 	return re.ReplaceAllString(msg, "$2")
 }
 
 func (p *DMR) mode(msg string) string {
-	re := regexp.MustCompile(p.Re())
+	re := Compiled(p)
 	return re.ReplaceAllString(msg, "$1")
 }
 
 func (p *DMR) query(msg string) string {
-	re := regexp.MustCompile(p.Re())
+	re := Compiled(p)
 	return re.ReplaceAllString(msg, "$3")
 }
 
-func (p *DMR) Process(from, post string) (string, func() string) {
+func (p *DMR) Process(ctx context.Context, _ *MessageContext, post string, _ Emitter) *Response {
 	mode := p.mode(post)
 	param := p.param(post)
 	search := p.query(post)
@@ -99,6 +97,7 @@ func (p *DMR) Process(from, post string) (string, func() string) {
 	u := fmt.Sprintf(endpoint, mode, params.Encode())
 
 	var req = HTTPRequest{
+		Context: ctx,
 		Timeout: 10 * time.Second,
 		URL:     u,
 		Method:  "GET",
@@ -110,11 +109,11 @@ func (p *DMR) Process(from, post string) (string, func() string) {
 		req.ResBody = res
 		err := req.DoJSON()
 		if err != nil {
-			return err.Error(), RespStub
+			return Error(err)
 		}
 
 		if res.Count == 0 {
-			return fmt.Sprintf("nothing found for '%s'", params.Encode()), RespStub
+			return Markdown(fmt.Sprintf("nothing found for '%s'", params.Encode()))
 		}
 
 		var s []string
@@ -123,18 +122,18 @@ func (p *DMR) Process(from, post string) (string, func() string) {
 		s = append(s, fmt.Sprintf("**Frequency**: %s", res.Results[0].Frequency))
 		s = append(s, fmt.Sprintf("**Offset**: %s", res.Results[0].Offset))
 
-		return strings.Join(s, ", "), RespStub
+		return Markdown(strings.Join(s, ", "))
 
 	case "user":
 		var res = &DMRUser{}
 		req.ResBody = res
 		err := req.DoJSON()
 		if err != nil {
-			return err.Error(), RespStub
+			return Error(err)
 		}
 
 		if res.Count == 0 {
-			return fmt.Sprintf("nothing found for '%s'", params.Encode()), RespStub
+			return Markdown(fmt.Sprintf("nothing found for '%s'", params.Encode()))
 		}
 
 		var s []string
@@ -142,15 +141,9 @@ func (p *DMR) Process(from, post string) (string, func() string) {
 		s = append(s, fmt.Sprintf("**ID**: %d", res.Results[0].ID))
 		s = append(s, fmt.Sprintf("**Callsign**: %s", res.Results[0].Callsign))
 
-		return strings.Join(s, ", "), RespStub
+		return Markdown(strings.Join(s, ", "))
 	}
-	return fmt.Sprintf("invalid mode: %q", mode), RespStub
-}
-
-// RespondText to looking up of DMR info
-func (p *DMR) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := p.Process(ev.Sender, post)
-	return SendMD(c, ev.RoomID, resp)
+	return Markdown(fmt.Sprintf("invalid mode: %q", mode))
 }
 
 // Name DMR!
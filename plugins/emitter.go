@@ -0,0 +1,108 @@
+package plugins
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Emitter lets plugins send responses besides the one Process returns:
+// follow-ups, progress updates and edits of earlier messages. It can be
+// used while Process runs and after it returns.
+type Emitter interface {
+	// Emit sends resp. It returns the ID of the message that was sent,
+	// which is empty for chats that can't edit messages (see
+	// MessageContext.Edits).
+	Emit(resp *Response) (string, error)
+
+	// Edit replaces the message id with resp. Chats that can't edit
+	// send resp as a new message.
+	Edit(id string, resp *Response) (string, error)
+
+	// After sends resp once d has passed, unless the bot shuts down
+	// first.
+	After(d time.Duration, resp *Response)
+}
+
+// Discard is an Emitter that drops everything.
+var Discard Emitter = discard{}
+
+type discard struct{}
+
+func (discard) Emit(*Response) (string, error)         { return "", nil }
+func (discard) Edit(string, *Response) (string, error) { return "", nil }
+func (discard) After(time.Duration, *Response)         {}
+
+// DefaultStreamEvery is how often a Stream edits its message.
+const DefaultStreamEvery = time.Second
+
+// Stream sends text that arrives in pieces, like the output of a language
+// model. On chats that can edit messages the text shows up as it grows,
+// elsewhere it is sent once the stream is closed.
+type Stream struct {
+	// Every is how often the message is edited.
+	Every time.Duration
+
+	emit  Emitter
+	edits bool
+	kind  Kind
+
+	mu   sync.Mutex
+	text strings.Builder
+	id   string
+	last time.Time
+}
+
+// NewStream creates a Stream of kind for the sender of mc.
+func NewStream(mc *MessageContext, emit Emitter, kind Kind) *Stream {
+	return &Stream{
+		Every: DefaultStreamEvery,
+		emit:  emit,
+		edits: mc.Edits,
+		kind:  kind,
+	}
+}
+
+// send sends or edits the message, the caller holds s.mu.
+func (s *Stream) send() error {
+	resp := &Response{Kind: s.kind, Text: s.text.String()}
+	s.last = time.Now()
+	if s.id == "" {
+		id, err := s.emit.Emit(resp)
+		s.id = id
+		return err
+	}
+	_, err := s.emit.Edit(s.id, resp)
+	return err
+}
+
+// Write adds p to the text, updating the message if it hasn't been
+// updated for a while.
+func (s *Stream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.text.Write(p)
+	if !s.edits || time.Since(s.last) < s.Every || strings.TrimSpace(s.text.String()) == "" {
+		return len(p), nil
+	}
+	return len(p), s.send()
+}
+
+// Len returns the length of the text written so far.
+func (s *Stream) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(strings.TrimSpace(s.text.String()))
+}
+
+// Close sends the complete text.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.TrimSpace(s.text.String()) == "" {
+		return nil
+	}
+	return s.send()
+}
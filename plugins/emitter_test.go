@@ -0,0 +1,53 @@
+package plugins
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+type testEmitter struct {
+	sent []string
+}
+
+func (e *testEmitter) Emit(resp *Response) (string, error) {
+	e.sent = append(e.sent, resp.Text)
+	return "1", nil
+}
+
+func (e *testEmitter) Edit(id string, resp *Response) (string, error) {
+	e.sent = append(e.sent, fmt.Sprintf("%s=%s", id, resp.Text))
+	return id, nil
+}
+
+func (e *testEmitter) After(time.Duration, *Response) {}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		edits bool
+		every time.Duration
+		want  string
+	}{
+		{edits: false, want: "[a b c]"},
+		{edits: true, want: "[a 1=a b 1=a b c 1=a b c]"},
+		{edits: true, every: time.Hour, want: "[a 1=a b c]"},
+	}
+
+	for _, tt := range tests {
+		e := &testEmitter{}
+		s := NewStream(&MessageContext{Edits: tt.edits}, e, KindText)
+		s.Every = tt.every
+		for _, part := range []string{"", "a", " b", " c"} {
+			if _, err := io.WriteString(s, part); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(e.sent); got != tt.want {
+			t.Errorf("edits %t every %s: expected %s; got %s\n", tt.edits, tt.every, tt.want, got)
+		}
+	}
+}
@@ -1,9 +1,11 @@
-package main
+package plugins
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"regexp"
 	"sort"
@@ -14,6 +16,9 @@ import (
 	"golang.org/x/net/html"
 )
 
+// errataInterval is how often we look for new errata.
+const errataInterval = 2 * time.Hour
+
 // Erratum are our individual chunks of errata
 type Erratum struct {
 	ID    int
@@ -207,3 +212,112 @@ func PrintErrataMD(e *Erratum) string {
 		e.Link,
 	)
 }
+
+// ErrataWatch posts new OpenBSD errata to the rooms listed in
+// "errata_rooms". The release is set with "openbsd_release" and the number
+// of errata we've seen is kept in "errata_count".
+type ErrataWatch struct {
+	db PluginStore
+	// URL is the base URL of the patches directory, defaults to
+	// ftp.openbsd.org.
+	URL string
+}
+
+// Descr describes this plugin
+func (e *ErrataWatch) Descr() string {
+	return "Watches for new OpenBSD errata."
+}
+
+// Re matches errata
+func (e *ErrataWatch) Re() string {
+	return `(?i)^errata:$`
+}
+
+// Match checks for "errata:"
+func (e *ErrataWatch) Match(_ *MessageContext, msg string) bool {
+	return Compiled(e).MatchString(msg)
+}
+
+// Settings lets ErrataWatch read the release, the rooms to notify and the
+// count of errata seen before plugins had buckets
+func (e *ErrataWatch) Settings() []string {
+	return []string{"openbsd_release", "errata_count", "errata_rooms"}
+}
+
+// SetStore sets the store
+func (e *ErrataWatch) SetStore(s PluginStore) {
+	e.db = s
+}
+
+// Process reports the number of errata we know about
+func (e *ErrataWatch) Process(_ context.Context, _ *MessageContext, _ string, _ Emitter) *Response {
+	release, err := e.db.Get("openbsd_release")
+	if err != nil {
+		return Error(err)
+	}
+	count, err := e.db.Get("errata_count")
+	if err != nil {
+		return Error(err)
+	}
+	return Text(fmt.Sprintf("OpenBSD %s has %s errata", release, count))
+}
+
+// Jobs checks for errata every errataInterval
+func (e *ErrataWatch) Jobs() []Job {
+	return []Job{{Name: e.Name(), Every: errataInterval, Run: e.check}}
+}
+
+func (e *ErrataWatch) check(post Poster) error {
+	var errataCount int
+	if err := GetJSON(e.db, "errata_count", &errataCount); err != nil {
+		return err
+	}
+	openbsdRelease, err := e.db.Get("openbsd_release")
+	if err != nil {
+		return err
+	}
+
+	base := e.URL
+	if base == "" {
+		base = "http://ftp.openbsd.org/pub/OpenBSD/patches"
+	}
+
+	got, err := ParseRemoteErrata(fmt.Sprintf("%s/%s/common/", base, openbsdRelease))
+	if err != nil {
+		return err
+	}
+
+	l := len(got.List)
+	if l <= errataCount {
+		return SetJSON(e.db, "errata_count", l)
+	}
+
+	alertRooms := List(e.db, "errata_rooms")
+	if len(alertRooms) == 0 {
+		return fmt.Errorf("no errata_rooms")
+	}
+
+	// The count is bumped as we go, so errata we fail to fetch are
+	// retried next time without repeating the ones already posted.
+	for i := errataCount; i < l; i++ {
+		erratum := got.List[i]
+		log.Printf("Notifying for erratum %03d\n", erratum.ID)
+		err = erratum.Fetch()
+		if err != nil {
+			return err
+		}
+		for _, room := range alertRooms {
+			post(room, PrintErrataMD(&erratum))
+		}
+		if err := SetJSON(e.db, "errata_count", i+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Name Errata
+func (e *ErrataWatch) Name() string {
+	return "Errata"
+}
@@ -0,0 +1,105 @@
+package plugins
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+const errataIndex = `<html><body><pre>
+<a href="../">../</a>
+<a href="002_bgpd.patch.sig">002_bgpd.patch.sig</a>
+<a href="001_xserver.patch.sig">001_xserver.patch.sig</a>
+</pre></body></html>`
+
+const erratumPatch = `untrusted comment: verify with openbsd-75-base.pub
+RWRGj1pRpprAfgYt6EkVYkSx8QaI2hjHiRYQwcFtnQbnOzQ2EtcNT2vhpukHmjFRqEmRNrOIkOrVA8Kl1HAkSmeSqOwMMfCTrgk=
+
+OpenBSD 7.5 errata 001, April 5, 2024:
+
+The X server could be crashed by a malicious client.
+
+Apply by doing:
+    signify -Vep /etc/signify/openbsd-75-base.pub -x 001_xserver.patch.sig \
+        -m - | (cd /usr/xenocara && patch -p0)
+
+Index: xserver/Xi/xiproperty.c
+`
+
+func errataServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/common/"):
+			fmt.Fprint(w, errataIndex)
+		case strings.HasSuffix(r.URL.Path, ".sig"):
+			fmt.Fprint(w, erratumPatch)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestParseErrata(t *testing.T) {
+	ts := errataServer()
+	defer ts.Close()
+
+	got, err := ParseRemoteErrata(ts.URL + "/7.5/common/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := len(got.List)
+	if l != 2 {
+		t.Fatalf("errata count %d; want 2", l)
+	}
+
+	erratum := got.List[0]
+	if erratum.ID != 1 {
+		t.Errorf("expected errata to be sorted; got %03d first", erratum.ID)
+	}
+
+	err = erratum.Fetch()
+	if err != nil {
+		t.Errorf("can't fetch data for erratum\n%s", err)
+	}
+	if d := erratum.Date.Format("2006-01-02"); d != "2024-04-05" {
+		t.Errorf("expected date 2024-04-05; got %s", d)
+	}
+	if !strings.HasPrefix(erratum.Patch, "Index: ") {
+		t.Errorf("unexpected patch: %q", erratum.Patch)
+	}
+}
+
+func TestErrataWatch(t *testing.T) {
+	ts := errataServer()
+	defer ts.Close()
+
+	store := mcstoretest.Map{
+		"errata_count":    "1",
+		"openbsd_release": "7.5",
+		"errata_rooms":    "#openbsd,#errata",
+	}
+	e := &ErrataWatch{URL: ts.URL}
+	e.SetStore(store)
+
+	var posted []string
+	post := func(room, message string) {
+		posted = append(posted, room)
+	}
+
+	for range 2 {
+		if err := e.Jobs()[0].Run(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fmt.Sprint(posted) != "[#openbsd #errata]" {
+		t.Errorf("expected one erratum posted to two rooms; got %q", posted)
+	}
+	if store["errata_count"] != "2" {
+		t.Errorf("expected errata_count 2; got %q", store["errata_count"])
+	}
+}
@@ -0,0 +1,301 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// execTimeout is used for exec plugins without "exec_<name>_timeout".
+const execTimeout = 10 * time.Second
+
+// execRequest is written to an exec plugin, one per line.
+type execRequest struct {
+	Context *MessageContext `json:"context"`
+	Message string          `json:"message"`
+}
+
+// ExecPlugin runs an external command as a plugin. Messages are written to
+// the command's stdin as JSON lines:
+//
+//	{"context": {"chat": "IRC", "sender": "qbit", ...}, "message": "..."}
+//
+// For each one the command writes a single JSON line back:
+//
+//	{"kind": "markdown", "text": "..."}
+//
+// An empty text means there is nothing to say. Commands that crash or time
+// out are restarted on the next message.
+type ExecPlugin struct {
+	PluginName  string
+	Command     []string
+	Pattern     string
+	Description string
+	Timeout     time.Duration
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	lines  chan []byte
+	exited chan struct{}
+}
+
+// LoadExecPlugins creates the exec plugins listed in "exec_plugins". Each
+// one is configured with "exec_<name>_cmd" (the command and its
+// arguments), "exec_<name>_re", "exec_<name>_descr" and optionally
+// "exec_<name>_timeout".
+func LoadExecPlugins(store PluginStore) ([]*ExecPlugin, error) {
+	var plugs []*ExecPlugin
+	for _, name := range List(store, "exec_plugins") {
+		key := func(k string) string {
+			return fmt.Sprintf("exec_%s_%s", name, k)
+		}
+
+		cmd, err := store.Get(key("cmd"))
+		if err != nil {
+			return nil, err
+		}
+		re, err := store.Get(key("re"))
+		if err != nil {
+			return nil, err
+		}
+		descr, _ := store.Get(key("descr"))
+
+		timeout := execTimeout
+		if t, err := store.Get(key("timeout")); err == nil {
+			timeout, err = time.ParseDuration(t)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key("timeout"), err)
+			}
+		}
+
+		e := &ExecPlugin{
+			PluginName:  name,
+			Command:     strings.Fields(cmd),
+			Pattern:     re,
+			Description: descr,
+			Timeout:     timeout,
+		}
+		if _, err := e.Paths(); err != nil {
+			return nil, fmt.Errorf("%s: %w", key("cmd"), err)
+		}
+		plugs = append(plugs, e)
+	}
+	return plugs, nil
+}
+
+// Paths returns the files that need to be executable for the plugin to
+// run: the command and, for scripts, the interpreter. Commands, and what
+// scripts starting with "#!/usr/bin/env" run, are looked up in PATH.
+func (e *ExecPlugin) Paths() ([]string, error) {
+	if len(e.Command) == 0 {
+		return nil, fmt.Errorf("no command")
+	}
+	cmd, err := exec.LookPath(e.Command[0])
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{cmd}
+
+	f, err := os.Open(cmd)
+	if err != nil {
+		return paths, nil
+	}
+	defer f.Close()
+
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	interp, ok := strings.CutPrefix(line, "#!")
+	fields := strings.Fields(interp)
+	if !ok || len(fields) == 0 {
+		return paths, nil
+	}
+	paths = append(paths, fields[0])
+
+	if filepath.Base(fields[0]) != "env" {
+		return paths, nil
+	}
+	for _, arg := range fields[1:] {
+		// Skip options, like -S, and variables env sets.
+		if strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+			continue
+		}
+		prog, err := exec.LookPath(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cmd, err)
+		}
+		return append(paths, prog), nil
+	}
+	return nil, fmt.Errorf("%s: can't tell what %q runs", cmd, strings.TrimSpace(interp))
+}
+
+// Descr returns the configured description
+func (e *ExecPlugin) Descr() string {
+	return e.Description
+}
+
+// Re returns the configured regex
+func (e *ExecPlugin) Re() string {
+	return e.Pattern
+}
+
+// Match checks the configured regex
+func (e *ExecPlugin) Match(_ *MessageContext, msg string) bool {
+	return Compiled(e).MatchString(msg)
+}
+
+// SetStore does nothing, exec plugins keep their own state
+func (e *ExecPlugin) SetStore(_ PluginStore) {}
+
+// Name returns the configured name
+func (e *ExecPlugin) Name() string {
+	return e.PluginName
+}
+
+// TimeLimit returns the configured timeout
+func (e *ExecPlugin) TimeLimit() time.Duration {
+	return e.Timeout
+}
+
+// Init starts the command
+func (e *ExecPlugin) Init() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.start()
+}
+
+// Close stops the command
+func (e *ExecPlugin) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stop()
+	return nil
+}
+
+func (e *ExecPlugin) start() error {
+	if len(e.Command) == 0 {
+		return fmt.Errorf("no command")
+	}
+
+	cmd := exec.Command(e.Command[0], e.Command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	lines := make(chan []byte)
+	exited := make(chan struct{})
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Printf("%s: %s", e.Name(), scanner.Text())
+		}
+	}()
+	go func() {
+		defer close(exited)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			lines <- append([]byte(nil), scanner.Bytes()...)
+		}
+		<-logged
+		log.Printf("%s: exited: %v", e.Name(), cmd.Wait())
+	}()
+
+	e.cmd, e.stdin, e.lines, e.exited = cmd, stdin, lines, exited
+	return nil
+}
+
+func (e *ExecPlugin) stop() {
+	if e.cmd == nil {
+		return
+	}
+	e.stdin.Close()
+	e.cmd.Process.Kill()
+
+	// Children of the command can keep stdout open after it is killed,
+	// drain it in the background so we don't have to wait for them.
+	lines, exited := e.lines, e.exited
+	go func() {
+		for {
+			select {
+			case <-lines:
+			case <-exited:
+				return
+			}
+		}
+	}()
+	e.cmd = nil
+}
+
+// request sends a single request and waits for the answer.
+func (e *ExecPlugin) request(ctx context.Context, req []byte) (*Response, error) {
+	if e.cmd == nil {
+		if err := e.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := e.stdin.Write(req); err != nil {
+		e.stop()
+		return nil, err
+	}
+
+	select {
+	case line := <-e.lines:
+		resp := &Response{}
+		if err := json.Unmarshal(line, resp); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		return resp, nil
+	case <-e.exited:
+		e.stop()
+		return nil, fmt.Errorf("exited without responding")
+	case <-time.After(e.Timeout):
+		e.stop()
+		return nil, fmt.Errorf("timed out after %s", e.Timeout)
+	case <-ctx.Done():
+		e.stop()
+		return nil, ctx.Err()
+	}
+}
+
+// Process hands the message to the command
+func (e *ExecPlugin) Process(ctx context.Context, mc *MessageContext, msg string, _ Emitter) *Response {
+	req, err := json.Marshal(execRequest{Context: mc, Message: msg})
+	if err != nil {
+		return Error(err)
+	}
+	req = append(req, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	resp, err := e.request(ctx, req)
+	if err != nil {
+		log.Printf("%s: %s", e.Name(), err)
+		return Errorf("sorry %s, %s is having trouble", mc.Name(), e.Name())
+	}
+	return resp
+}
@@ -0,0 +1,121 @@
+package plugins
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+const execScript = `#!/bin/sh
+while read -r line; do
+	case "$line" in
+	*'"message":"slow"'*) sleep 5 ;;
+	*'"message":"crash"'*) exit 1 ;;
+	*) echo '{"kind": "markdown", "text": "*hi*"}' ;;
+	esac
+done
+`
+
+func TestExecPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("needs /bin/sh")
+	}
+
+	script := filepath.Join(t.TempDir(), "hi.sh")
+	if err := os.WriteFile(script, []byte(execScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	plugs, err := LoadExecPlugins(mcstoretest.Map{
+		"exec_plugins":    "hi",
+		"exec_hi_cmd":     script,
+		"exec_hi_re":      `^exec`,
+		"exec_hi_timeout": "500ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := plugs[0]
+	if err := e.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if p, err := e.Paths(); err != nil || strings.Join(p, " ") != script+" /bin/sh" {
+		t.Errorf("unexpected paths: %q (%v)\n", p, err)
+	}
+
+	mc := &MessageContext{Chat: "Test", Sender: "qbit"}
+	for _, msg := range []string{"hi", "slow", "hi", "crash", "hi"} {
+		start := time.Now()
+		resp := e.Process(context.Background(), mc, msg, Discard)
+		switch msg {
+		case "hi":
+			if resp.Kind != KindMarkdown || resp.Text != "*hi*" {
+				t.Errorf("%s: unexpected response: %#v\n", msg, resp)
+			}
+		default:
+			if resp.Kind != KindError {
+				t.Errorf("%s: expected an error; got %#v\n", msg, resp)
+			}
+			if time.Since(start) > 2*time.Second {
+				t.Errorf("%s: took too long", msg)
+			}
+		}
+	}
+}
+
+func TestExecPaths(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("needs #! scripts")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	python := filepath.Join(dir, "python3")
+	if err := os.WriteFile(python, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	testScripts := []struct {
+		shebang string
+		paths   string
+	}{
+		{"#!/bin/sh", "/bin/sh"},
+		{"#!/usr/bin/env python3", "/usr/bin/env " + python},
+		{"#!/usr/bin/env -S PYTHONPATH=. python3 -u", "/usr/bin/env " + python},
+		{"#!/usr/bin/env ruby", ""},
+		{"#!/usr/bin/env", ""},
+	}
+
+	for _, ts := range testScripts {
+		script := filepath.Join(dir, "script")
+		if err := os.WriteFile(script, []byte(ts.shebang+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadExecPlugins(mcstoretest.Map{
+			"exec_plugins":    "script",
+			"exec_script_cmd": "script",
+			"exec_script_re":  "^script",
+		})
+		paths, perr := (&ExecPlugin{Command: []string{"script"}}).Paths()
+		if ts.paths == "" {
+			if err == nil || perr == nil {
+				t.Errorf("%q: expected an error; got %q\n", ts.shebang, paths)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s\n", ts.shebang, err)
+		}
+		if want := script + " " + ts.paths; strings.Join(paths, " ") != want {
+			t.Errorf("%q: expected %q; got %q\n", ts.shebang, want, paths)
+		}
+	}
+}
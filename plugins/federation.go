@@ -1,12 +1,10 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"net/url"
-	"regexp"
 	"time"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // ServiceInfo represents the version info from a response
@@ -37,25 +35,25 @@ func (h *Feder) Re() string {
 }
 
 func (h *Feder) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	return re.ReplaceAllString(msg, "$1")
 }
 
 // Match determines if we should call the response for Feder
-func (h *Feder) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Feder) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
 // SetStore we don't need a store here.
 func (h *Feder) SetStore(_ PluginStore) {}
 
-func (h *Feder) Process(from, post string) (string, func() string) {
+func (h *Feder) Process(ctx context.Context, mc *MessageContext, post string, _ Emitter) *Response {
 	homeServer := h.fix(post)
 	if homeServer != "" {
 		u, err := url.Parse(fmt.Sprintf("https://%s", homeServer))
 		if err != nil {
-			return fmt.Sprintf("that's not a real host name: %q", homeServer), RespStub
+			return Text(fmt.Sprintf("that's not a real host name: %q", homeServer))
 		}
 
 		homeServer = u.Hostname()
@@ -67,6 +65,7 @@ func (h *Feder) Process(from, post string) (string, func() string) {
 		var fed = &FedResp{}
 
 		var req = HTTPRequest{
+			Context: ctx,
 			Timeout: 5 * time.Second,
 			URL:     furl,
 			Method:  "GET",
@@ -75,7 +74,7 @@ func (h *Feder) Process(from, post string) (string, func() string) {
 		err = req.DoJSON()
 
 		if err != nil {
-			return fmt.Sprintf("sorry %s, I can't look up the federation status (%s)", from, err), RespStub
+			return Errorf("sorry %s, I can't look up the federation status (%s)", mc.Name(), err)
 		}
 
 		stat := "broken"
@@ -84,18 +83,12 @@ func (h *Feder) Process(from, post string) (string, func() string) {
 		}
 
 		if fed.Info.Error != "" {
-			return fmt.Sprintf("%s seems to be broken, maybe it isn't a homeserver?\n%s", homeServer, fed.Info.Error), RespStub
+			return Text(fmt.Sprintf("%s seems to be broken, maybe it isn't a homeserver?\n%s", homeServer, fed.Info.Error))
 		} else {
-			return fmt.Sprintf("%s is running %s (%s) and is %s.", homeServer, fed.Info.Name, fed.Info.Version, stat), RespStub
+			return Text(fmt.Sprintf("%s is running %s (%s) and is %s.", homeServer, fed.Info.Name, fed.Info.Version, stat))
 		}
 	}
-	return "invalid hostname", RespStub
-}
-
-// RespondText to looking up of federation check requests
-func (h *Feder) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendText(c, ev.RoomID, resp)
+	return Text("invalid hostname")
 }
 
 // Name Feder!
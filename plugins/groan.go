@@ -1,10 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"math/rand"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Groan responds to groans.
@@ -25,12 +23,12 @@ func (h *Groan) Re() string {
 func (h *Groan) SetStore(_ PluginStore) {}
 
 // Match determines if we should bother groaning
-func (h *Groan) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Groan) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
-func (h *Groan) Process(_, _ string) (string, func() string) {
+func (h *Groan) Process(_ context.Context, _ *MessageContext, _ string, _ Emitter) *Response {
 	a := []string{
 		"Ugh.",
 		"ugh",
@@ -40,13 +38,7 @@ func (h *Groan) Process(_, _ string) (string, func() string) {
 		"........",
 	}
 
-	return a[rand.Intn(len(a))], RespStub
-}
-
-// RespondText to groan events
-func (h *Groan) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process("", "")
-	return SendText(c, ev.RoomID, resp)
+	return Text(a[rand.Intn(len(a))])
 }
 
 // Name returns the name of the Groan plugin
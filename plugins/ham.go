@@ -1,12 +1,10 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // LicenseResp represents a response from http://hamdb.org/api
@@ -51,13 +49,13 @@ func (h *Ham) Re() string {
 }
 
 func (h *Ham) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	return re.ReplaceAllString(msg, "$1")
 }
 
 // Match determines if we should call the response for Ham
-func (h *Ham) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Ham) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
@@ -79,7 +77,7 @@ func (h *Ham) pretty(resp *LicenseResp) string {
 }
 
 // Process does the heavy lifting
-func (h *Ham) Process(from, post string) (string, func() string) {
+func (h *Ham) Process(ctx context.Context, mc *MessageContext, post string, _ Emitter) *Response {
 	call := h.fix(post)
 	if call != "" {
 		furl := fmt.Sprintf("http://api.hamdb.org/v1/%s/json/mcchunkie",
@@ -88,6 +86,7 @@ func (h *Ham) Process(from, post string) (string, func() string) {
 
 		var res = &LicenseResp{}
 		var req = HTTPRequest{
+			Context: ctx,
 			Timeout: 15 * time.Second,
 			URL:     furl,
 			Method:  "GET",
@@ -96,23 +95,17 @@ func (h *Ham) Process(from, post string) (string, func() string) {
 
 		err := req.DoJSON()
 		if err != nil {
-			return fmt.Sprintf("sorry %s, I can't look things up in ULS (%s)", from, err), RespStub
+			return Errorf("sorry %s, I can't look things up in ULS (%s)", mc.Name(), err)
 		}
 
 		if res.Hamdb.Messages.Status == "OK" {
-			return h.pretty(res), RespStub
+			return Text(h.pretty(res))
 		}
 
-		return fmt.Sprintf("sorry %s, I can't look things up in ULS. The response was not OK.", from), RespStub
+		return Errorf("sorry %s, I can't look things up in ULS. The response was not OK.", mc.Name())
 	}
 
-	return "invalid callsign", RespStub
-}
-
-// RespondText to looking up of federation check requests
-func (h *Ham) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendText(c, ev.RoomID, resp)
+	return Text("invalid callsign")
 }
 
 // Name Ham!
@@ -1,11 +1,9 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
 	"strings"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Help responds to hi messages
@@ -23,13 +21,13 @@ func (h *Help) Re() string {
 }
 
 // Match determines if we are highfiving
-func (h *Help) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Help) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
 func (h *Help) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	return re.ReplaceAllString(msg, "$1")
 }
 
@@ -37,27 +35,17 @@ func (h *Help) fix(msg string) string {
 func (h *Help) SetStore(_ PluginStore) {}
 
 // Process does the lifting
-func (h *Help) Process(from, post string) (string, func() string) {
+func (h *Help) Process(_ context.Context, _ *MessageContext, post string, _ Emitter) *Response {
 	item := h.fix(post)
 
 	var pnames []string
 	for _, plg := range Plugs {
 		if strings.ToLower(plg.Name()) == strings.ToLower(item) {
-			return fmt.Sprintf("**%s**: `%s` -  _%s_\n", plg.Name(), plg.Re(), plg.Descr()), func() string { return "" }
+			return Markdown(fmt.Sprintf("**%s**: `%s` -  _%s_\n", plg.Name(), plg.Re(), plg.Descr()))
 		}
 		pnames = append(pnames, plg.Name())
 	}
-	return fmt.Sprintf("no help found for %q, available: %s", item, strings.Join(pnames, ", ")), func() string { return "" }
-}
-
-// RespondText to hi events
-func (h *Help) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, delayedResp := h.Process(ev.Sender, post)
-	go func() {
-		SendText(c, ev.RoomID, delayedResp())
-	}()
-
-	return SendText(c, ev.RoomID, resp)
+	return Markdown(fmt.Sprintf("no help found for %q, available: %s", item, strings.Join(pnames, ", ")))
 }
 
 // Name hi
@@ -1,10 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Hi responds to hi messages
@@ -22,28 +20,18 @@ func (h *Hi) Re() string {
 }
 
 // Match determines if we are highfiving
-func (h *Hi) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
-	return re.MatchString(msg) && ToMe(user, msg)
+func (h *Hi) Match(mc *MessageContext, msg string) bool {
+	re := Compiled(h)
+	return re.MatchString(msg) && mc.ToMe(msg)
 }
 
 // SetStore we don't need a store here
 func (h *Hi) SetStore(_ PluginStore) {}
 
 // Process does the lifting
-func (h *Hi) Process(from, post string) (string, func() string) {
-	s := NameRE.ReplaceAllString(from, "$1")
-	return fmt.Sprintf("hi %s!", s), RespStub
-}
-
-// RespondText to hi events
-func (h *Hi) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, delayedResp := h.Process(ev.Sender, post)
-	go func() {
-		SendText(c, ev.RoomID, delayedResp())
-	}()
-
-	return SendText(c, ev.RoomID, resp)
+func (h *Hi) Process(_ context.Context, mc *MessageContext, post string, _ Emitter) *Response {
+	s := mc.Name()
+	return Text(fmt.Sprintf("hi %s!", s))
 }
 
 // Name hi
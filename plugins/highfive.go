@@ -1,10 +1,9 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // HighFive high fives!
@@ -19,6 +18,11 @@ func leftFive() string {
 	return `\\o`
 }
 
+var (
+	rightFiveRE = regexp.MustCompile(rightFive())
+	leftFiveRE  = regexp.MustCompile(leftFive())
+)
+
 // Descr describes this plugin
 func (h *HighFive) Descr() string {
 	return "Everyone loves highfives."
@@ -33,32 +37,23 @@ func (h *HighFive) Re() string {
 func (h *HighFive) SetStore(_ PluginStore) {}
 
 // Match determines if we should bother giving a high five
-func (h *HighFive) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
-	return ToMe(user, msg) && re.MatchString(msg)
+func (h *HighFive) Match(mc *MessageContext, msg string) bool {
+	re := Compiled(h)
+	return mc.ToMe(msg) && re.MatchString(msg)
 }
 
-func (h *HighFive) Process(from, post string) (string, func() string) {
-	s := NameRE.ReplaceAllString(from, "$1")
+func (h *HighFive) Process(_ context.Context, mc *MessageContext, post string, _ Emitter) *Response {
+	s := mc.Name()
 
-	rm := regexp.MustCompile(rightFive())
-	lm := regexp.MustCompile(leftFive())
-
-	if rm.MatchString(post) {
-		return fmt.Sprintf("\\o %s", s), func() string { return "" }
+	if rightFiveRE.MatchString(post) {
+		return Text(fmt.Sprintf("\\o %s", s))
 	}
 
-	if lm.MatchString(post) {
-		return fmt.Sprintf("%s o/", s), func() string { return "" }
+	if leftFiveRE.MatchString(post) {
+		return Text(fmt.Sprintf("%s o/", s))
 	}
 
-	return "\\o/", func() string { return "" }
-}
-
-// RespondText to high five events
-func (h *HighFive) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendText(c, ev.RoomID, resp)
+	return Text("\\o/")
 }
 
 // Name returns the name of the HighFive plugin
@@ -13,7 +13,7 @@ func TestHighFiveMatch(t *testing.T) {
 
 	h := &HighFive{}
 	for msg, should := range testStrings {
-		if h.Match("", msg) != should {
+		if h.Match(&MessageContext{}, msg) != should {
 			t.Errorf("HighFive expected to match %q (%t); but doesn't\n", msg, should)
 		}
 	}
@@ -1,16 +1,12 @@
 package plugins
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // HomesteadResp is the json returned from our api
@@ -39,9 +35,9 @@ func (h *Homestead) SetStore(s PluginStore) {
 	h.db = s
 }
 
-func (h *Homestead) get(loc string) (*HomesteadResp, error) {
+func (h *Homestead) get(ctx context.Context, loc string) (*HomesteadResp, error) {
 	u := "https://graph.tapenet.org/_pub"
-	resp, err := http.Get(u)
+	resp, err := httpGet(ctx, u)
 	if err != nil {
 		return nil, err
 	}
@@ -73,38 +69,37 @@ func (h *Homestead) Re() string {
 }
 
 // Match checks for "home: name?" messages
-func (h *Homestead) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Homestead) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
 func (h *Homestead) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	return re.ReplaceAllString(msg, "$1")
 }
 
-func (h *Homestead) Process(from, post string) string {
+func (h *Homestead) Process(ctx context.Context, mc *MessageContext, post string, _ Emitter) *Response {
 	weather := h.fix(post)
 	var s []string
-	wd, err := h.get(weather)
+	wd, err := h.get(ctx, weather)
 	if err != nil {
-		return fmt.Sprintf("sorry %s, I can't connect to the homestead. %q", from, err)
+		return Errorf("sorry %s, I can't connect to the homestead. %q", mc.Name(), err)
 	}
 
 	for _, e := range wd.Data.Result {
-		if temp, err := strconv.ParseFloat(e.Value[1].(string), 64); err == nil {
-			s = append(s, fmt.Sprintf("%s: %.2fC (%.2fF)", e.Metric.Name, temp, (temp*1.8000)+32.00))
-		} else {
-			log.Fatal(err)
+		if len(e.Value) < 2 {
+			return Errorf("sorry %s, the homestead sent a bad reading for %s.", mc.Name(), e.Metric.Name)
+		}
+		v, _ := e.Value[1].(string)
+		temp, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return Errorf("sorry %s, the homestead sent a bad reading for %s: %q", mc.Name(), e.Metric.Name, err)
 		}
+		s = append(s, fmt.Sprintf("%s: %.2fC (%.2fF)", e.Metric.Name, temp, (temp*1.8000)+32.00))
 	}
 
-	return strings.Join(s, ", ")
-}
-
-// RespondText to looking up of weather lookup requests
-func (h *Homestead) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	return SendText(c, ev.RoomID, h.Process(ev.Sender, post))
+	return Text(strings.Join(s, ", "))
 }
 
 // Name Homestead!
@@ -0,0 +1,171 @@
+package plugins
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// linkTimeout is how long a link code stays valid.
+const linkTimeout = 10 * time.Minute
+
+// Identity returns the network qualified identity of sender on chat, for
+// example "matrix:@qbit:tapenet.org" or "irc:qbit".
+func Identity(chat, sender string) string {
+	return fmt.Sprintf("%s:%s", strings.ToLower(chat), sender)
+}
+
+func identityKey(id string) string {
+	return fmt.Sprintf("identity_%s", base32.StdEncoding.EncodeToString([]byte(id)))
+}
+
+// Resolve returns the canonical user ID for the sender of mc. Identities
+// that haven't been linked are their own canonical ID.
+func Resolve(store PluginStore, mc *MessageContext) string {
+	id := Identity(mc.Chat, mc.Sender)
+	if user, err := store.Get(identityKey(id)); err == nil && user != "" {
+		return user
+	}
+	return id
+}
+
+// Link makes canonical the user ID of the identity id.
+func Link(store PluginStore, id, canonical string) error {
+	return store.Set(identityKey(id), canonical)
+}
+
+// Unlink removes the link for the identity id.
+func Unlink(store PluginStore, id string) error {
+	return store.Set(identityKey(id), "")
+}
+
+// UserKey returns a store key for per user data. Keys are based on the
+// canonical user ID so the data is shared by every linked identity.
+func UserKey(mc *MessageContext, key string) string {
+	return base32.StdEncoding.EncodeToString(fmt.Appendf(nil, "%s_%s", key, mc.User))
+}
+
+type pendingLink struct {
+	user    string
+	expires time.Time
+}
+
+// Linker links identities from different chats to one user. "link:" sent
+// directly to the bot gives out a code, sending "link: <code>" from
+// another chat links that identity to the first.
+type Linker struct {
+	db      PluginStore
+	mu      sync.Mutex
+	pending map[string]pendingLink
+}
+
+// Descr describes this plugin
+func (l *Linker) Descr() string {
+	return "Link your identities on different chats. Send `link:` directly to get a code, then `link: <code>` from the other chat. `unlink:` undoes it."
+}
+
+// Re matches link commands
+func (l *Linker) Re() string {
+	return `(?i)^(?P<cmd>link|unlink):(?: (?P<code>\w+))?$`
+}
+
+// Match checks for "link:" and "unlink:"
+func (l *Linker) Match(_ *MessageContext, msg string) bool {
+	return Compiled(l).MatchString(msg)
+}
+
+// Privileged gives Linker the main store, it manages identities
+func (l *Linker) Privileged() bool {
+	return true
+}
+
+// SetStore sets the store
+func (l *Linker) SetStore(s PluginStore) {
+	l.db = s
+}
+
+func (l *Linker) newCode(user string) (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.EncodeToString(b)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.pending == nil {
+		l.pending = map[string]pendingLink{}
+	}
+	for c, p := range l.pending {
+		if time.Now().After(p.expires) {
+			delete(l.pending, c)
+		}
+	}
+	l.pending[code] = pendingLink{user: user, expires: time.Now().Add(linkTimeout)}
+
+	return code, nil
+}
+
+func (l *Linker) useCode(code string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p, ok := l.pending[strings.ToUpper(code)]
+	delete(l.pending, strings.ToUpper(code))
+	if !ok || time.Now().After(p.expires) {
+		return "", false
+	}
+	return p.user, true
+}
+
+// Process hands out codes and links identities. Unverified senders (see
+// MessageContext) can't do either, anyone could claim to be them.
+func (l *Linker) Process(_ context.Context, mc *MessageContext, _ string, _ Emitter) *Response {
+	id := Identity(mc.Chat, mc.Sender)
+	code := mc.Captures["code"]
+
+	if mc.Unverified {
+		return Errorf("sorry %s, I can't tell that this is really you", mc.Name())
+	}
+
+	if strings.EqualFold(mc.Captures["cmd"], "unlink") {
+		if err := Unlink(l.db, id); err != nil {
+			return Error(err)
+		}
+		return Text(fmt.Sprintf("%s is no longer linked", id))
+	}
+
+	if code == "" {
+		if !mc.Direct {
+			return Errorf("sorry %s, send that to me directly", mc.Name())
+		}
+		code, err := l.newCode(mc.User)
+		if err != nil {
+			return Error(err)
+		}
+		return Text(fmt.Sprintf("send \"link: %s\" to me from your other chat within %s", code, linkTimeout))
+	}
+
+	user, ok := l.useCode(code)
+	if !ok {
+		return Errorf("sorry %s, that code is invalid or expired", mc.Name())
+	}
+	if user == id {
+		return Errorf("sorry %s, that code was meant for another chat", mc.Name())
+	}
+
+	if err := Link(l.db, id, user); err != nil {
+		return Error(err)
+	}
+	return Text(fmt.Sprintf("%s is now linked to %s", id, user))
+}
+
+// Name Link
+func (l *Linker) Name() string {
+	return "Link"
+}
@@ -0,0 +1,75 @@
+package plugins
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestLinker(t *testing.T) {
+	store := mcstoretest.Map{"acl_owner": "matrix:@qbit:tapenet.org"}
+	l := &Linker{}
+	l.SetStore(store)
+
+	matrix := &MessageContext{Chat: "Matrix", Sender: "@qbit:tapenet.org", Direct: true}
+	irc := &MessageContext{Chat: "IRC", Sender: "qbit"}
+
+	if r := RoleOf(store, irc); r != RoleUser {
+		t.Fatalf("expected unlinked IRC user to be a user; got %s\n", r)
+	}
+
+	run := func(mc *MessageContext, msg string) *Response {
+		mc.User = Resolve(store, mc)
+		mc.Captures = Captures(Compiled(l), msg)
+		resp := l.Process(context.Background(), mc, msg, Discard)
+		return resp
+	}
+
+	if resp := run(&MessageContext{Chat: "Matrix", Sender: "@qbit:tapenet.org"}, "link:"); resp.Kind != KindError {
+		t.Error("expected codes to only be sent directly")
+	}
+
+	resp := run(matrix, "link:")
+	code := regexp.MustCompile(`link: (\w+)`).FindStringSubmatch(resp.Text)
+	if code == nil {
+		t.Fatalf("no code in %q\n", resp.Text)
+	}
+
+	if resp := run(irc, "link: nope"); resp.Kind != KindError {
+		t.Error("expected invalid codes to fail")
+	}
+
+	mail := &MessageContext{Chat: "Mail", Sender: "qbit@tapenet.org", Direct: true, Unverified: true}
+	if resp := run(mail, "link: "+code[1]); resp.Kind != KindError {
+		t.Error("expected unverified senders to not be able to use codes")
+	}
+	if resp := run(mail, "link:"); resp.Kind != KindError {
+		t.Error("expected unverified senders to not get codes")
+	}
+	if Resolve(store, mail) != "mail:qbit@tapenet.org" {
+		t.Errorf("expected unverified sender to stay unlinked; got %q\n", Resolve(store, mail))
+	}
+
+	if resp := run(irc, "link: "+code[1]); resp.Kind == KindError {
+		t.Fatal(resp.Text)
+	}
+
+	irc.User = ""
+	if r := RoleOf(store, irc); r != RoleOwner {
+		t.Errorf("expected linked IRC user to be an owner; got %s\n", r)
+	}
+	if UserKey(irc, "test") != UserKey(matrix, "test") {
+		t.Error("expected linked users to share keys")
+	}
+
+	if resp := run(irc, "link: "+code[1]); resp.Kind != KindError {
+		t.Error("expected codes to only work once")
+	}
+
+	run(irc, "unlink:")
+	if Resolve(store, irc) != "irc:qbit" {
+		t.Errorf("expected unlinked user to be irc:qbit; got %q\n", Resolve(store, irc))
+	}
+}
@@ -0,0 +1,92 @@
+package plugins
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Initializer is implemented by plugins that need to set things up before
+// handling messages. Init is called once, after SetStore. Plugins that fail
+// to initialize are disabled.
+type Initializer interface {
+	Init() error
+}
+
+// Closer is implemented by plugins that need to clean up on shutdown.
+type Closer interface {
+	Close() error
+}
+
+// Poster sends a message to a room on every enabled chat.
+type Poster func(room, message string)
+
+// Job is a function run periodically by a Scheduler.
+type Job struct {
+	Name  string
+	Every time.Duration
+	Run   func(post Poster) error
+}
+
+// Ticker is implemented by plugins that have background work to do.
+type Ticker interface {
+	Jobs() []Job
+}
+
+// run runs the job once, turning a panic into an error so one bad job
+// can't take down the bot.
+func (j Job) run(post Poster) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return j.Run(post)
+}
+
+// Scheduler runs jobs until it is stopped. Each job runs right away and
+// then every Job.Every.
+type Scheduler struct {
+	post Poster
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewScheduler creates a Scheduler whose jobs post with post.
+func NewScheduler(post Poster) *Scheduler {
+	return &Scheduler{
+		post: post,
+		stop: make(chan struct{}),
+	}
+}
+
+// Add starts running job.
+func (s *Scheduler) Add(job Job) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		t := time.NewTicker(job.Every)
+		defer t.Stop()
+
+		for {
+			if err := job.run(s.post); err != nil {
+				log.Printf("%s: %s", job.Name, err)
+			}
+
+			select {
+			case <-s.stop:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// Stop stops all jobs, waiting for running ones to finish.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
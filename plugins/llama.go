@@ -2,16 +2,12 @@ package plugins
 
 import (
 	"context"
-	"errors"
-	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"regexp"
-	"slices"
-	"strings"
+	"time"
 
-	"github.com/matrix-org/gomatrix"
 	"github.com/ollama/ollama/api"
 )
 
@@ -29,52 +25,52 @@ func (l *Llama) Re() string {
 	return `(?i)^o?llama:(.+)$`
 }
 
-func (l *Llama) Match(_, msg string) bool {
-	re := regexp.MustCompile(l.Re())
+func (l *Llama) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(l)
 	return re.MatchString(msg)
 }
 
-func (l *Llama) SetStore(s PluginStore) {
-	l.db = s
+// Role restricts Llama to owners
+func (l *Llama) Role() Role {
+	return RoleOwner
 }
 
-func (l *Llama) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, delayedResp := l.Process(ev.Sender, post)
-	go func() {
-		SendText(c, ev.RoomID, delayedResp())
-	}()
+// TimeLimit gives ollama some time to think
+func (l *Llama) TimeLimit() time.Duration {
+	return 2 * time.Minute
+}
 
-	return SendMD(c, ev.RoomID, resp)
+// Settings lets Llama read the ollama server
+func (l *Llama) Settings() []string {
+	return []string{"ollama_host"}
 }
 
-func (l *Llama) Process(from, msg string) (string, func() string) {
-	var err error
-	ctx := context.Background()
+func (l *Llama) SetStore(s PluginStore) {
+	l.db = s
+}
 
-	re := regexp.MustCompile(l.Re())
-	query := re.ReplaceAllString(msg, "$1")
+// Init sets up the ollama client for "ollama_host"
+func (l *Llama) Init() error {
 	llamaServer, err := l.db.Get("ollama_host")
 	if err != nil {
-		return err.Error(), RespStub
+		return err
 	}
 
-	botOwners, err := l.db.Get("bot_owners")
+	u, err := url.Parse(llamaServer)
 	if err != nil {
-		return err.Error(), RespStub
-	}
-	log.Println("owners, from", botOwners, from)
-	if !slices.Contains(strings.Split(botOwners, ","), from) {
-		return errors.New(fmt.Sprintf("sorry, %s, I can't let you do that.", from)).Error(), RespStub
+		return err
 	}
+	l.client = api.NewClient(u, http.DefaultClient)
 
-	if l.client == nil {
-		u, err := url.Parse(llamaServer)
-		if err != nil {
-			return err.Error(), RespStub
-		}
-		l.client = api.NewClient(u, http.DefaultClient)
-	}
+	return nil
+}
+
+// Process streams the answer on chats that can edit messages (see Stream)
+func (l *Llama) Process(ctx context.Context, mc *MessageContext, msg string, emit Emitter) *Response {
+	var err error
 
+	re := Compiled(l)
+	query := re.ReplaceAllString(msg, "$1")
 	messages := []api.Message{
 		{
 			Role:    "system",
@@ -91,16 +87,28 @@ func (l *Llama) Process(from, msg string) (string, func() string) {
 		Messages: messages,
 	}
 
-	respSet := []string{}
+	stream := NewStream(mc, emit, KindMarkdown)
 	err = l.client.Chat(ctx, req, func(resp api.ChatResponse) error {
-		respSet = append(respSet, resp.Message.Content)
-		return nil
+		_, err := io.WriteString(stream, resp.Message.Content)
+		return err
 	})
 	if err != nil {
 		log.Println(err)
+		if stream.Len() == 0 {
+			return Error(err)
+		}
 	}
 
-	return strings.Join(respSet, ""), RespStub
+	if err := stream.Close(); err != nil {
+		log.Println(err)
+	}
+	if err != nil {
+		// Part of the answer was sent, say why the rest is missing.
+		if _, err := emit.Emit(Error(err)); err != nil {
+			log.Println(err)
+		}
+	}
+	return nil
 }
 
 func (l *Llama) Name() string {
@@ -0,0 +1,49 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestLlamaErrors(t *testing.T) {
+	tests := []struct {
+		handler http.HandlerFunc
+		want    string
+	}{
+		{func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, `{"error": "model not found"}`, http.StatusNotFound)
+		}, "[]"},
+		{func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "half"}}`)
+			fmt.Fprintln(w, `{"error": "out of memory"}`)
+		}, "[half out of memory]"},
+	}
+
+	for i, tt := range tests {
+		srv := httptest.NewServer(tt.handler)
+		l := &Llama{}
+		l.SetStore(mcstoretest.Map{"ollama_host": srv.URL})
+		if err := l.Init(); err != nil {
+			t.Fatal(err)
+		}
+
+		e := &testEmitter{}
+		resp := l.Process(context.Background(), &MessageContext{Sender: "qbit"}, "llama: hi", e)
+		srv.Close()
+
+		if tt.want == "[]" && (resp == nil || resp.Kind != KindError) {
+			t.Errorf("%d: expected an error response; got %#v\n", i, resp)
+		}
+		if tt.want != "[]" && resp != nil {
+			t.Errorf("%d: expected the error to follow the stream; got %#v\n", i, resp)
+		}
+		if got := fmt.Sprint(e.sent); got != tt.want {
+			t.Errorf("%d: expected %s; got %s\n", i, tt.want, got)
+		}
+	}
+}
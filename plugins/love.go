@@ -1,10 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"math/rand"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // LoveYou responds to love messages
@@ -22,13 +20,13 @@ func (h *LoveYou) Re() string {
 }
 
 // Match checks for 'i love you' and a reference to the bot name
-func (h *LoveYou) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
-	return re.MatchString(msg) && ToMe(user, msg)
+func (h *LoveYou) Match(mc *MessageContext, msg string) bool {
+	re := Compiled(h)
+	return re.MatchString(msg) && mc.ToMe(msg)
 }
 
 // Process does the heavy lifting
-func (h *LoveYou) Process(from, post string) (string, func() string) {
+func (h *LoveYou) Process(_ context.Context, _ *MessageContext, post string, _ Emitter) *Response {
 	a := []string{
 		"I am not ready for this kind of relationship!",
 		"ಠ_ಠ",
@@ -37,22 +35,12 @@ func (h *LoveYou) Process(from, post string) (string, func() string) {
 		"hawkard!",
 	}
 
-	return a[rand.Intn(len(a))], RespStub
+	return Text(a[rand.Intn(len(a))])
 }
 
 // SetStore we don't need a store, so just return
 func (h *LoveYou) SetStore(_ PluginStore) {}
 
-// RespondText to love events
-func (h *LoveYou) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, _ string) error {
-	resp, delayedResp := h.Process("", "")
-	go func() {
-		SendText(c, ev.RoomID, delayedResp())
-	}()
-
-	return SendText(c, ev.RoomID, resp)
-}
-
 // Name i love you
 func (h *LoveYou) Name() string {
 	return "LoveYou"
@@ -0,0 +1,198 @@
+package plugins
+
+import (
+	"context"
+	"encoding/base32"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMoreExpiry is how long held back lines are kept, it can be
+// changed with "more_expiry".
+const DefaultMoreExpiry = 10 * time.Minute
+
+// MoreLine is the line added to replies when lines are held back.
+func MoreLine(n int) string {
+	if n == 1 {
+		return "(1 more line, say `more`)"
+	}
+	return fmt.Sprintf("(%d more lines, say `more`)", n)
+}
+
+// Results creates a markdown response listing items, one per line, after
+// an optional header. Chats show as many lines as they comfortably can and
+// hold back the rest for "more" (see Pager).
+func Results(header string, items []string) *Response {
+	if header != "" {
+		items = append([]string{header}, items...)
+	}
+	return Markdown(strings.Join(items, "\n"))
+}
+
+// cursor is what is left of a reply.
+type cursor struct {
+	Kind    Kind      `json:"kind"`
+	Lines   []string  `json:"lines"`
+	Expires time.Time `json:"expires"`
+}
+
+// Pager keeps the lines of long replies that chats held back, for each
+// person in each room, until they ask for "more" or the lines expire.
+// Cursors are kept in memory. If Store is set they are saved there too, so
+// they survive restarts.
+type Pager struct {
+	Expiry time.Duration
+	Store  PluginStore
+
+	mu      sync.Mutex
+	cursors map[string]*cursor
+	now     func() time.Time
+}
+
+// NewPager creates a Pager, store may be nil.
+func NewPager(store PluginStore) *Pager {
+	return &Pager{
+		Expiry:  DefaultMoreExpiry,
+		Store:   store,
+		cursors: map[string]*cursor{},
+		now:     time.Now,
+	}
+}
+
+func pagerKey(mc *MessageContext) string {
+	user := mc.User
+	if user == "" {
+		user = Identity(mc.Chat, mc.Sender)
+	}
+	return fmt.Sprintf("%s %s %s", strings.ToLower(mc.Chat), mc.Room, user)
+}
+
+func pagerStoreKey(key string) string {
+	return fmt.Sprintf("more_%s", base32.StdEncoding.EncodeToString([]byte(key)))
+}
+
+// Hold keeps lines of kind for mc, replacing what was held before.
+func (p *Pager) Hold(mc *MessageContext, kind Kind, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, c := range p.cursors {
+		if p.now().After(c.Expires) {
+			delete(p.cursors, k)
+		}
+	}
+
+	key := pagerKey(mc)
+	c := &cursor{Kind: kind, Lines: lines, Expires: p.now().Add(p.Expiry)}
+	p.cursors[key] = c
+
+	if p.Store != nil {
+		if err := SetJSON(p.Store, pagerStoreKey(key), c); err != nil {
+			log.Printf("more: can't save lines for %q: %s", key, err)
+		}
+	}
+}
+
+// get returns the cursor of key, if it hasn't expired.
+func (p *Pager) get(key string) *cursor {
+	c, ok := p.cursors[key]
+	if !ok && p.Store != nil {
+		if Has(p.Store, pagerStoreKey(key)) {
+			c = &cursor{}
+			if err := GetJSON(p.Store, pagerStoreKey(key), c); err != nil {
+				log.Printf("more: can't load lines for %q: %s", key, err)
+				return nil
+			}
+			p.cursors[key] = c
+		}
+	}
+	if c == nil || p.now().After(c.Expires) {
+		return nil
+	}
+	return c
+}
+
+// Waiting reports whether mc has lines waiting.
+func (p *Pager) Waiting(mc *MessageContext) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.get(pagerKey(mc)) != nil
+}
+
+// Next returns the lines waiting for mc, nil if there are none. The chat
+// holds back what doesn't fit again.
+func (p *Pager) Next(mc *MessageContext) *Response {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := pagerKey(mc)
+	c := p.get(key)
+	if _, held := p.cursors[key]; held {
+		delete(p.cursors, key)
+		if p.Store != nil {
+			if err := p.Store.Set(pagerStoreKey(key), ""); err != nil {
+				log.Printf("more: can't remove lines for %q: %s", key, err)
+			}
+		}
+	}
+	if c == nil {
+		return nil
+	}
+	return &Response{Kind: c.Kind, Text: strings.Join(c.Lines, "\n")}
+}
+
+// PagerUser is implemented by plugins that want to know about the
+// dispatcher's Pager.
+type PagerUser interface {
+	SetPager(p *Pager)
+}
+
+// More shows the lines that were held back from long replies.
+type More struct {
+	pager *Pager
+}
+
+// Descr describes this plugin
+func (m *More) Descr() string {
+	return "Show more of a long reply."
+}
+
+// Re matches more
+func (m *More) Re() string {
+	return `(?i)^more$`
+}
+
+// Match checks for "more" when there is more to show
+func (m *More) Match(mc *MessageContext, msg string) bool {
+	return Compiled(m).MatchString(msg) && m.pager != nil && m.pager.Waiting(mc)
+}
+
+// Essential keeps "more" working wherever other plugins do
+func (m *More) Essential() bool {
+	return true
+}
+
+// SetStore we don't need a store here
+func (m *More) SetStore(_ PluginStore) {}
+
+// SetPager sets the pager we read from
+func (m *More) SetPager(p *Pager) {
+	m.pager = p
+}
+
+// Process sends the next lines
+func (m *More) Process(_ context.Context, mc *MessageContext, _ string, _ Emitter) *Response {
+	return m.pager.Next(mc)
+}
+
+// Name More
+func (m *More) Name() string {
+	return "More"
+}
@@ -0,0 +1,51 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestPager(t *testing.T) {
+	store := mcstoretest.Map{}
+	mc := &MessageContext{Chat: "IRC", Room: "#mcchunkie", Sender: "qbit"}
+
+	p := NewPager(store)
+	p.Hold(mc, KindText, []string{"one", "two"})
+
+	// A new pager, as after a restart, finds the lines in the store.
+	p = NewPager(store)
+	if !p.Waiting(mc) {
+		t.Fatal("expected lines to be waiting")
+	}
+	if p.Waiting(&MessageContext{Chat: "IRC", Room: "#mcchunkie", Sender: "rando"}) {
+		t.Error("expected nothing waiting for someone else")
+	}
+	if resp := p.Next(mc); resp.Text != "one\ntwo" {
+		t.Errorf("expected the held lines; got %q\n", resp.Text)
+	}
+	if p.Next(mc) != nil || p.Waiting(mc) {
+		t.Error("expected nothing left")
+	}
+	if _, ok := store[pagerStoreKey(pagerKey(mc))]; !ok {
+		t.Fatal("expected the held lines to be removed from the store")
+	}
+	delete(store, pagerStoreKey(pagerKey(mc)))
+	p.Next(mc)
+	if _, ok := store[pagerStoreKey(pagerKey(mc))]; ok {
+		t.Error("expected nothing to be written when nothing is held")
+	}
+
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	p.Hold(mc, KindText, []string{"three"})
+	now = now.Add(p.Expiry + time.Second)
+	if p.Waiting(mc) {
+		t.Error("expected lines to expire")
+	}
+	p.Hold(&MessageContext{Chat: "IRC", Room: "#mcchunkie", Sender: "rando"}, KindText, []string{"four"})
+	if len(p.cursors) != 1 {
+		t.Errorf("expected expired lines to be dropped; got %d held\n", len(p.cursors))
+	}
+}
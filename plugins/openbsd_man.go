@@ -1,10 +1,9 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // OpenBSDMan responds to beer requests
@@ -22,7 +21,7 @@ func (h *OpenBSDMan) Re() string {
 }
 
 func (h *OpenBSDMan) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	resp := ""
 	section := re.ReplaceAllString(msg, "$1")
 	if section == msg {
@@ -42,30 +41,20 @@ func (h *OpenBSDMan) fix(msg string) string {
 }
 
 // Match checks for our man page re
-func (h *OpenBSDMan) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *OpenBSDMan) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
 // SetStore does nothing in OpenBSDMan
 func (h *OpenBSDMan) SetStore(_ PluginStore) {}
 
-func (h *OpenBSDMan) Process(from, post string) (string, func() string) {
+func (h *OpenBSDMan) Process(_ context.Context, _ *MessageContext, post string, _ Emitter) *Response {
 	page := h.fix(post)
 	if page != "" {
-		return fmt.Sprintf("https://man.openbsd.org/%s", page), RespStub
+		return Text(fmt.Sprintf("https://man.openbsd.org/%s", page))
 	}
-	return "...", RespStub
-}
-
-// RespondText sends back a man page.
-func (h *OpenBSDMan) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, delayedResp := h.Process(ev.Sender, post)
-	go func() {
-		SendText(c, ev.RoomID, delayedResp())
-	}()
-
-	return SendText(c, ev.RoomID, resp)
+	return Text("...")
 }
 
 // Name OpenBSDMan!
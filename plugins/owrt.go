@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,11 +9,9 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"regexp"
 	"slices"
 	"strings"
-
-	"github.com/matrix-org/gomatrix"
+	"sync"
 )
 
 type OWRTData struct {
@@ -42,7 +41,10 @@ func loadJson(name string) (*OWRTData, error) {
 	d := &OWRTData{}
 
 	if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
-		err = fetchJson(name)
+		if err := fetchJson(name); err != nil {
+			os.Remove(name)
+			return nil, err
+		}
 	}
 
 	f, err := os.Open(name)
@@ -72,6 +74,31 @@ func getRow(d []any, c []int) []string {
 
 // OWRT lets one query openwrt's device db for compatible devices
 type OWRT struct {
+	mu   sync.Mutex
+	data *OWRTData
+}
+
+// Init loads the device db. Failing to fetch it isn't fatal, we try again
+// when someone asks for a device.
+func (h *OWRT) Init() error {
+	if _, err := h.load(); err != nil {
+		log.Printf("OWRT: %s", err)
+	}
+	return nil
+}
+
+func (h *OWRT) load() (*OWRTData, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.data == nil {
+		d, err := loadJson("/tmp/toh.json")
+		if err != nil {
+			return nil, err
+		}
+		h.data = d
+	}
+	return h.data, nil
 }
 
 // Descr describes this plugin
@@ -85,27 +112,21 @@ func (h *OWRT) Re() string {
 }
 
 // Match determines if we are asking for a beat
-func (h *OWRT) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *OWRT) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
 func (h *OWRT) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	return re.ReplaceAllString(msg, "$1")
 }
 
 // SetStore we don't need a store here
 func (h *OWRT) SetStore(_ PluginStore) {}
 
-// RespondText to beat request events
-func (h *OWRT) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, _ string) error {
-	resp, _ := h.Process("", "")
-	return SendText(c, ev.RoomID, resp)
-}
-
 // Process does the heavy lifting of calculating .beat
-func (h *OWRT) Process(from, msg string) (string, func() string) {
+func (h *OWRT) Process(_ context.Context, _ *MessageContext, msg string, _ Emitter) *Response {
 	var (
 		colSet = []int{}
 		cols   = []string{
@@ -118,9 +139,9 @@ func (h *OWRT) Process(from, msg string) (string, func() string) {
 		device = strings.ToLower(h.fix(msg))
 	)
 
-	d, err := loadJson("/tmp/toh.json")
+	d, err := h.load()
 	if err != nil {
-		log.Fatal(err)
+		return Error(err)
 	}
 
 	for _, name := range cols {
@@ -146,9 +167,10 @@ func (h *OWRT) Process(from, msg string) (string, func() string) {
 	}
 
 	if len(rowEntries) == 0 {
-		return fmt.Sprintf("nothing found for %q", device), RespStub
+		return Text(fmt.Sprintf("nothing found for %q", device))
 	}
-	return strings.Join(resp, "\n"), RespStub
+	slices.Sort(resp)
+	return Results(fmt.Sprintf("found %d devices for %q:", len(resp), device), resp)
 }
 
 // Name beat
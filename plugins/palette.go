@@ -1,12 +1,12 @@
 package plugins
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"image"
 	"image/color"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
+	"image/png"
 )
 
 // Palette responds to color messages
@@ -24,8 +24,8 @@ func (h *Palette) Re() string {
 }
 
 // Match determines if we are asking for a color
-func (h *Palette) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Palette) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
@@ -56,12 +56,8 @@ func isEdge(x, y int) bool {
 	return false
 }
 
-func (h *Palette) Process(_, _ string) (string, func() string) {
-	return "not supported", RespStub
-}
-
-// RespondText to color request events
-func (h *Palette) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
+// Process creates the image for the requested color
+func (h *Palette) Process(_ context.Context, _ *MessageContext, post string, _ Emitter) *Response {
 	const width, height = 56, 56
 
 	img := image.NewRGBA(image.Rect(0, 0, 56, 56))
@@ -73,8 +69,7 @@ func (h *Palette) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post st
 	}
 	clr, err := h.parseHexColor(post)
 	if err != nil {
-		fmt.Println(err)
-		return SendText(c, ev.RoomID, fmt.Sprintf("%s", err))
+		return Error(err)
 	}
 
 	for y := 0; y < height; y++ {
@@ -87,12 +82,13 @@ func (h *Palette) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post st
 		}
 	}
 
-	err = SendImage(c, ev.RoomID, img)
+	buf := new(bytes.Buffer)
+	err = png.Encode(buf, img)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return Error(err)
 	}
-	return nil
+
+	return Image(buf.Bytes(), post)
 }
 
 // Name color
@@ -0,0 +1,31 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+)
+
+func TestPaletteProcess(t *testing.T) {
+	p := &Palette{}
+	resp := p.Process(context.Background(), &MessageContext{}, "#ff0000", Discard)
+	if resp.Kind != KindImage {
+		t.Fatalf("Palette expected an image; got %v (%q)\n", resp.Kind, resp)
+	}
+
+	img, err := png.Decode(bytes.NewReader(resp.Image))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, g, b, _ := img.At(10, 10).RGBA()
+	if r != 0xffff || g != 0 || b != 0 {
+		t.Errorf("Palette expected red; got %x %x %x\n", r, g, b)
+	}
+
+	resp = p.Process(context.Background(), &MessageContext{}, "#zzzzzz", Discard)
+	if resp.Kind != KindError {
+		t.Errorf("Palette expected an error; got %v\n", resp.Kind)
+	}
+}
@@ -1,15 +1,13 @@
 package plugins
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
-	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
-	"github.com/matrix-org/gomatrix"
 )
 
 // PGP is our plugin type
@@ -31,17 +29,17 @@ func (p *PGP) Re() string {
 }
 
 // Match checks for "pgp: " messages
-func (p *PGP) Match(_, msg string) bool {
-	re := regexp.MustCompile(p.Re())
+func (p *PGP) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(p)
 	return re.MatchString(msg)
 }
 
 func (p *PGP) fix(msg string) string {
-	re := regexp.MustCompile(p.Re())
+	re := Compiled(p)
 	return strings.ToUpper(re.ReplaceAllString(msg, "$1"))
 }
 
-func (p *PGP) Process(from, post string) (string, func() string) {
+func (p *PGP) Process(ctx context.Context, _ *MessageContext, post string, _ Emitter) *Response {
 	search := p.fix(post)
 	searchURL := "https://keys.openpgp.org//vks/v1/by-fingerprint/%s"
 
@@ -51,21 +49,21 @@ func (p *PGP) Process(from, post string) (string, func() string) {
 
 	escSearch, err := url.Parse(search)
 	if err != nil {
-		return err.Error(), RespStub
+		return Error(err)
 	}
 
 	u := fmt.Sprintf(searchURL, escSearch)
 
-	resp, err := http.Get(u)
+	resp, err := httpGet(ctx, u)
 	if err != nil {
-		return err.Error(), RespStub
+		return Error(err)
 	}
 
 	defer resp.Body.Close()
 
 	kr, err := openpgp.ReadArmoredKeyRing(resp.Body)
 	if err != nil {
-		return err.Error(), RespStub
+		return Error(err)
 	}
 
 	var ids []string
@@ -78,15 +76,9 @@ func (p *PGP) Process(from, post string) (string, func() string) {
 			hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])))
 	}
 
-	return fmt.Sprintf("%s\n\n%s",
+	return Markdown(fmt.Sprintf("%s\n\n%s",
 		strings.Join(ids, "\n"),
-		strings.Join(fps, "\n")), RespStub
-}
-
-// RespondText to looking up of PGP info
-func (p *PGP) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := p.Process(ev.Sender, post)
-	return SendMD(c, ev.RoomID, resp)
+		strings.Join(fps, "\n")))
 }
 
 // Name PGP!
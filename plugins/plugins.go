@@ -2,24 +2,21 @@ package plugins
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"image"
-	"image/png"
 	"io"
-	"log"
 	"net/http"
 	"regexp"
 	"strings"
 	"time"
-
-	"github.com/gomarkdown/markdown"
-	"github.com/matrix-org/gomatrix"
 )
 
 // PluginStore matches MCStore. This allows the main store to be used by
-// plugins.
+// plugins. Setting a key to "" stores an empty value: Get returns it
+// without an error, but it counts as unset for Has and isn't listed or
+// exported by MCStore.
 type PluginStore interface {
-	Set(key, values string)
+	Set(key, values string) error
 	Get(key string) (string, error)
 }
 
@@ -31,7 +28,7 @@ type Plugin interface {
 
 	// Match determines if the plugin's main Respond function should be
 	// called
-	Match(user, message string) bool
+	Match(mc *MessageContext, message string) bool
 
 	// Name should return the human readable name of the bot
 	Name() string
@@ -39,22 +36,51 @@ type Plugin interface {
 	// Re returns the regular expression that a plugin uses to "match"
 	Re() string
 
-	// RespondMatrix responds to a Matrix "m.text" event
-	RespondText(c *gomatrix.Client, ev *gomatrix.Event, user, path string) error
-
-	// Process is the processed response from the plugin. This is useful for
-	// running the plugins outside of the context of Matrix.
-	Process(from, message string) (string, func() string)
+	// Process is the processed response from the plugin. ctx is canceled
+	// when the plugin runs out of time. emit sends any other responses,
+	// like follow-ups, progress updates or edits.
+	Process(ctx context.Context, mc *MessageContext, message string, emit Emitter) *Response
 
 	// SetStore exposes the top level MCStore to a plugin
 	SetStore(s PluginStore)
 }
 
+// Prioritizer can be implemented by plugins that need to be consulted
+// before or after the others. Higher priorities go first.
+type Prioritizer interface {
+	Priority() int
+}
+
+// TimeLimiter can be implemented by plugins that need more (or less) time
+// than the dispatcher gives them by default.
+type TimeLimiter interface {
+	TimeLimit() time.Duration
+}
+
+// TimeLimit returns how long p may take to respond, def for plugins that
+// don't implement TimeLimiter.
+func TimeLimit(p Plugin, def time.Duration) time.Duration {
+	if tl, ok := p.(TimeLimiter); ok {
+		return tl.TimeLimit()
+	}
+	return def
+}
+
+// Priority returns the priority of a plugin. Plugins that don't implement
+// Prioritizer have a priority of 0.
+func Priority(p Plugin) int {
+	if pr, ok := p.(Prioritizer); ok {
+		return pr.Priority()
+	}
+	return 0
+}
+
 // NameRE matches the "friendly" name. This is typically used in tab
 // completion.
 var NameRE = regexp.MustCompile(`@(.+):.+$`)
 
-// ToMe returns true of the message pertains to the bot
+// ToMe returns true of the message pertains to the bot. Plugins should use
+// MessageContext.ToMe, which knows about names on all chats.
 func ToMe(user, message string) bool {
 	u := NameRE.ReplaceAllString(user, "$1")
 	return strings.Contains(message, u)
@@ -66,12 +92,9 @@ func RemoveName(user, message string) string {
 	return strings.ReplaceAll(message, n+": ", "")
 }
 
-func RespStub() string {
-	return ""
-}
-
 // HTTPRequest has the bits for making http requests
 type HTTPRequest struct {
+	Context context.Context
 	Client  http.Client
 	Headers map[string]string
 	Request *http.Request
@@ -90,6 +113,10 @@ func (h *HTTPRequest) setup() error {
 		h.Method = "GET"
 	}
 
+	if h.Context == nil {
+		h.Context = context.Background()
+	}
+
 	if h.ReqBody != nil {
 		// We have a request to send to the server
 		buf := new(bytes.Buffer)
@@ -97,10 +124,10 @@ func (h *HTTPRequest) setup() error {
 		if err != nil {
 			return err
 		}
-		h.Request, err = http.NewRequest(h.Method, h.URL, buf)
+		h.Request, err = http.NewRequestWithContext(h.Context, h.Method, h.URL, buf)
 	} else {
 		// Just gimme dem datas
-		h.Request, err = http.NewRequest(h.Method, h.URL, nil)
+		h.Request, err = http.NewRequestWithContext(h.Context, h.Method, h.URL, nil)
 	}
 
 	if err != nil {
@@ -109,7 +136,6 @@ func (h *HTTPRequest) setup() error {
 
 	if h.Headers != nil {
 		for k, v := range h.Headers {
-			log.Println(k, v)
 			h.Request.Header.Set(k, v)
 		}
 	}
@@ -150,161 +176,13 @@ func (h *HTTPRequest) DoJSON() (err error) {
 	return nil
 }
 
-// SendText sends a text message to a given room. It pretends to be
-// "typing" by calling UserTyping for the caller.
-func SendText(c *gomatrix.Client, roomID, message string) error {
-	_, err := c.UserTyping(roomID, true, 3)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.SendText(roomID, message)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.UserTyping(roomID, false, 0)
+// httpGet is http.Get for requests that can be canceled with ctx.
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// SendEmote sends an emote to a given room. It pretends to be
-// "typing" by calling UserTyping for the caller.
-func SendEmote(c *gomatrix.Client, roomID, message string) error {
-	_, err := c.UserTyping(roomID, true, 3)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.SendMessageEvent(roomID, "m.room.message", gomatrix.GetHTMLMessage("m.emote", message))
-	if err != nil {
-		return err
-	}
-
-	_, err = c.UserTyping(roomID, false, 0)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// SendHTML sends an html message to a given room. It pretends to be
-// "typing" by calling UserTyping for the caller.
-func SendHTML(c *gomatrix.Client, roomID, message string) error {
-	_, err := c.UserTyping(roomID, true, 3)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.SendMessageEvent(roomID, "m.room.message", gomatrix.GetHTMLMessage("m.text", message))
-	if err != nil {
-		return err
-	}
-
-	_, err = c.UserTyping(roomID, false, 0)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// SendMDNotice sends an html notice to a given room. It pretends to be
-// "typing" by calling UserTyping for the caller.
-func SendMDNotice(c *gomatrix.Client, roomID, message string) error {
-	_, err := c.UserTyping(roomID, true, 3)
-	if err != nil {
-		return err
-	}
-
-	md := []byte(message)
-	html := markdown.ToHTML(md, nil, nil)
-	_, err = c.SendMessageEvent(roomID, "m.room.message", gomatrix.GetHTMLMessage("m.notice", string(html)))
-	if err != nil {
-		return err
-	}
-
-	_, err = c.UserTyping(roomID, false, 0)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// SendUnescNotice sends an text notice to a given room. It pretends to be
-// "typing" by calling UserTyping for the caller.
-func SendUnescNotice(c *gomatrix.Client, roomID, message string) error {
-	_, err := c.UserTyping(roomID, true, 3)
-	if err != nil {
-		return err
-	}
-
-	// Undo the escaping
-	_, err = c.SendMessageEvent(roomID, "m.room.message", gomatrix.HTMLMessage{
-		Body:          message,
-		MsgType:       "m.notice",
-		Format:        "org.matrix.custom.text",
-		FormattedBody: message,
-	})
-	if err != nil {
-		return err
-	}
-
-	_, err = c.UserTyping(roomID, false, 0)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// SendNotice sends an text notice to a given room. It pretends to be
-// "typing" by calling UserTyping for the caller.
-func SendNotice(c *gomatrix.Client, roomID, message string) error {
-	_, err := c.UserTyping(roomID, true, 3)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.SendMessageEvent(roomID, "m.room.message", gomatrix.GetHTMLMessage("m.notice", message))
-	if err != nil {
-		return err
-	}
-
-	_, err = c.UserTyping(roomID, false, 0)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// SendMD takes markdown and converts it to an html message.
-func SendMD(c *gomatrix.Client, roomID, message string) error {
-	md := []byte(message)
-	html := markdown.ToHTML(md, nil, nil)
-	return SendHTML(c, roomID, string(html))
-}
-
-// SendImage takes an image and sends it!.
-func SendImage(c *gomatrix.Client, roomID string, img *image.RGBA) error {
-	r, w := io.Pipe()
-
-	go func() {
-		defer w.Close()
-		_ = png.Encode(w, img)
-	}()
-
-	mediaURL, err := c.UploadToContentRepo(r, "image/png", 0)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.SendImage(roomID, "embedded_image.png", mediaURL.ContentURI)
-	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return nil
+	return http.DefaultClient.Do(req)
 }
 
 // Plugins is a collection of our plugins. An instance of this is iterated
@@ -312,38 +190,52 @@ func SendImage(c *gomatrix.Client, roomID string, img *image.RGBA) error {
 type Plugins []Plugin
 
 // Plugs defines the "enabled" plugins.
-var Plugs = Plugins{
-	&BananaStab{},
-	&Beat{},
-	&Beer{},
-	&BotSnack{},
-	&DMR{},
-	&Feder{},
-	&Groan{},
-	&Ham{},
-	&Help{},
-	&HighFive{},
-	&Hi{},
-	&Llama{},
-	&LoveYou{},
-	&OWRT{},
-	&OpenBSDMan{},
-	&PGP{},
-	&Palette{},
-	&RFC{},
-	&ROA{},
-	&Remind{},
-	&Salute{},
-	&Simple{},
-	&Snap{},
-	&Songwhip{},
-	&Source{},
-	&Thanks{},
-	&Toki{},
-	&Version{},
-	&Wb{},
-	&Weather{},
-	&Yeah{},
+var Plugs = NewPlugs()
+
+// NewPlugs returns new instances of the "enabled" plugins. Plugins keep
+// state, like pending link codes, so tests get their own.
+func NewPlugs() Plugins {
+	return Plugins{
+		&BananaStab{},
+		&Beat{},
+		&Beer{},
+		&BotSnack{},
+		&Custom{},
+		&DMR{},
+		&ErrataWatch{},
+		&Feder{},
+		&Groan{},
+		&Ham{},
+		&Help{},
+		&HighFive{},
+		&Hi{},
+		&Ignorer{},
+		&Linker{},
+		&Llama{},
+		&LoveYou{},
+		&More{},
+		&OWRT{},
+		&OpenBSDMan{},
+		&PGP{},
+		&Palette{},
+		&Policy{},
+		&RFC{},
+		&ROA{},
+		&Remind{},
+		&Roles{},
+		&Salute{},
+		&Simple{},
+		&Snap{},
+		&Songwhip{},
+		&Source{},
+		&Status{},
+		&Thanks{},
+		&Toki{},
+		&Version{},
+		&Wb{},
+		&Weather{},
+		&Yeah{},
+	}
 }
 
 func (p *Plugins) List() string {
@@ -29,6 +29,18 @@ func TestPluginsRemoveName(t *testing.T) {
 	}
 }
 
+func TestMessageContextName(t *testing.T) {
+	mc := &MessageContext{Sender: "@test:test.com"}
+	if n := mc.Name(); n != "@test:test.com" {
+		t.Errorf("Name expected '@test:test.com'; got %q\n", n)
+	}
+
+	mc.DisplayName = "test"
+	if n := mc.Name(); n != "test" {
+		t.Errorf("Name expected 'test'; got %q\n", n)
+	}
+}
+
 type testResp struct {
 	Name string `json:"test"`
 }
@@ -0,0 +1,215 @@
+package plugins
+
+import (
+	"context"
+	"encoding/base32"
+	"fmt"
+	"slices"
+	"strings"
+
+	"suah.dev/mcchunkie/mcstore"
+)
+
+// Essential is implemented by plugins that can't be disabled, either with
+// -dp or a policy. Without this it would be possible to lock ourselves out
+// of changing policies.
+type Essential interface {
+	Essential() bool
+}
+
+// policyKey returns the store key for a policy list. Chat wide lists are
+// stored as "plugins_<allow|deny|only>_<chat>", room lists get the base32
+// encoded room appended.
+func policyKey(list string, mc *MessageContext, room bool) string {
+	key := fmt.Sprintf("plugins_%s_%s", list, strings.ToLower(mc.Chat))
+	if room {
+		key = fmt.Sprintf("%s_%s", key, base32.StdEncoding.EncodeToString([]byte(mc.Room)))
+	}
+	return key
+}
+
+func hasName(list []string, name string) bool {
+	return slices.ContainsFunc(list, func(s string) bool {
+		return strings.EqualFold(s, name)
+	})
+}
+
+// Allowed reports whether p may respond to messages described by mc. Room
+// policies are checked before chat policies. A deny list blocks the plugins
+// it names, an allow list lets them through the chat policies. An only list
+// blocks everything that isn't on it or allowed.
+func Allowed(store PluginStore, mc *MessageContext, p Plugin) bool {
+	if e, ok := p.(Essential); ok && e.Essential() {
+		return true
+	}
+
+	for _, room := range []bool{true, false} {
+		if hasName(List(store, policyKey("deny", mc, room)), p.Name()) {
+			return false
+		}
+		if hasName(List(store, policyKey("allow", mc, room)), p.Name()) {
+			return true
+		}
+		if only := List(store, policyKey("only", mc, room)); len(only) > 0 {
+			return hasName(only, p.Name())
+		}
+	}
+
+	return true
+}
+
+// Without returns the plugins whose names aren't in names (case
+// insensitive). Essential plugins are always kept.
+func (p Plugins) Without(names []string) Plugins {
+	var plugs Plugins
+	for _, plg := range p {
+		if e, ok := plg.(Essential); !(ok && e.Essential()) && hasName(names, plg.Name()) {
+			continue
+		}
+		plugs = append(plugs, plg)
+	}
+	return plugs
+}
+
+// PluginsUser is implemented by plugins that want to know about all the
+// plugins of the dispatcher, exec plugins included.
+type PluginsUser interface {
+	SetPlugins(plugs Plugins)
+}
+
+// Policy lets bot owners change which plugins are allowed in a room or chat.
+type Policy struct {
+	db    PluginStore
+	plugs Plugins
+}
+
+// Descr describes this plugin
+func (p *Policy) Descr() string {
+	return "Allow or deny plugins in a room (or the whole chat with `chat`), or turn off all but `only` some. Owners only."
+}
+
+// Re matches our policy commands
+func (p *Policy) Re() string {
+	return `(?i)^plugins: (allow|deny|only|clear|show)(?: (room|chat))?(?: (.+))?$`
+}
+
+// Match checks for "plugins: " messages
+func (p *Policy) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(p)
+	return re.MatchString(msg)
+}
+
+// Essential keeps Policy from being disabled
+func (p *Policy) Essential() bool {
+	return true
+}
+
+// Role restricts Policy to owners
+func (p *Policy) Role() Role {
+	return RoleOwner
+}
+
+// Privileged gives Policy the main store, it manages policies
+func (p *Policy) Privileged() bool {
+	return true
+}
+
+// SetStore sets the store
+func (p *Policy) SetStore(s PluginStore) {
+	p.db = s
+}
+
+// SetPlugins sets the plugins policies can name
+func (p *Policy) SetPlugins(plugs Plugins) {
+	p.plugs = plugs
+}
+
+// names resolves the requested plugin names to the names of known plugins.
+func (p *Policy) names(list string) ([]string, error) {
+	plugs := p.plugs
+	if plugs == nil {
+		plugs = Plugs
+	}
+	var names []string
+	for _, n := range mcstore.SplitList(list) {
+		idx := slices.IndexFunc(plugs, func(plg Plugin) bool {
+			return strings.EqualFold(plg.Name(), n)
+		})
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown plugin %q", n)
+		}
+		names = append(names, plugs[idx].Name())
+	}
+	return names, nil
+}
+
+// Process updates or shows the policies
+func (p *Policy) Process(_ context.Context, mc *MessageContext, msg string, _ Emitter) *Response {
+	re := Compiled(p)
+	parts := re.FindStringSubmatch(msg)
+	cmd, scope := strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	room := scope != "chat"
+	if scope == "" {
+		scope = "room"
+	}
+
+	names, err := p.names(parts[3])
+	if err != nil {
+		return Error(err)
+	}
+
+	if cmd != "clear" && cmd != "show" && len(names) == 0 {
+		return Errorf("which plugins should I %s?", cmd)
+	}
+
+	allowKey, denyKey, onlyKey := policyKey("allow", mc, room), policyKey("deny", mc, room), policyKey("only", mc, room)
+	allow, deny, only := List(p.db, allowKey), List(p.db, denyKey), List(p.db, onlyKey)
+
+	without := func(list []string) []string {
+		return slices.DeleteFunc(list, func(s string) bool {
+			return hasName(names, s)
+		})
+	}
+	with := func(list []string) []string {
+		for _, n := range names {
+			if !hasName(list, n) {
+				list = append(list, n)
+			}
+		}
+		return list
+	}
+
+	switch cmd {
+	case "allow":
+		allow, deny = with(allow), without(deny)
+	case "deny":
+		allow, deny, only = without(allow), with(deny), without(only)
+	case "only":
+		deny, only = without(deny), with(only)
+	case "clear":
+		if len(names) == 0 {
+			allow, deny, only = nil, nil, nil
+		} else {
+			allow, deny, only = without(allow), without(deny), without(only)
+		}
+	}
+
+	if cmd != "show" {
+		for key, list := range map[string][]string{allowKey: allow, denyKey: deny, onlyKey: only} {
+			if err := p.db.Set(key, strings.Join(list, ",")); err != nil {
+				return Error(err)
+			}
+		}
+	}
+
+	s := fmt.Sprintf("%s allow: %q, deny: %q, only: %q", scope, allow, deny, only)
+	if len(only) > 0 {
+		s += fmt.Sprintf(", every other plugin is off in this %s", scope)
+	}
+	return Text(s)
+}
+
+// Name Policy
+func (p *Policy) Name() string {
+	return "Policy"
+}
@@ -0,0 +1,89 @@
+package plugins
+
+import (
+	"context"
+	"testing"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestPolicy(t *testing.T) {
+	store := mcstoretest.Map{}
+	p := &Policy{}
+	p.SetStore(store)
+
+	busy := &MessageContext{Chat: "IRC", Room: "#busy", Sender: "@owner:test.com"}
+	quiet := &MessageContext{Chat: "IRC", Room: "#quiet", Sender: "@owner:test.com"}
+	dm := &MessageContext{Chat: "Matrix", Room: "!dm:test.com", Sender: "@owner:test.com"}
+
+	for _, cmd := range []string{
+		"plugins: deny hi,thanks",
+		"plugins: deny chat Beer",
+		"plugins: allow chat Hi",
+	} {
+		resp := p.Process(context.Background(), busy, cmd, Discard)
+		if resp.Kind == KindError {
+			t.Fatalf("%q: %s\n", cmd, resp.Text)
+		}
+	}
+
+	testAllowed := []struct {
+		mc      *MessageContext
+		plug    Plugin
+		allowed bool
+	}{
+		{busy, &Hi{}, false},
+		{busy, &Thanks{}, false},
+		{busy, &Beer{}, false},
+		{busy, &Policy{}, true},
+		{quiet, &Hi{}, true},
+		{quiet, &Thanks{}, true},
+		{dm, &Hi{}, true},
+		{dm, &Thanks{}, true},
+	}
+
+	for _, ta := range testAllowed {
+		if a := Allowed(store, ta.mc, ta.plug); a != ta.allowed {
+			t.Errorf("%s in %s: expected %t; got %t\n", ta.plug.Name(), ta.mc.Room, ta.allowed, a)
+		}
+	}
+
+	resp := p.Process(context.Background(), busy, "plugins: clear", Discard)
+	if resp.Kind == KindError {
+		t.Fatal(resp.Text)
+	}
+	if !Allowed(store, busy, &Hi{}) {
+		t.Error("Hi expected to be allowed after clearing the room")
+	}
+
+	resp = p.Process(context.Background(), quiet, "plugins: only Beer", Discard)
+	if resp.Kind == KindError {
+		t.Fatal(resp.Text)
+	}
+	if !Allowed(store, quiet, &Beer{}) || Allowed(store, quiet, &Hi{}) {
+		t.Error("expected only Beer in #quiet, the room overrides the chat")
+	}
+
+	if Required(p) != RoleOwner {
+		t.Error("expected Policy to be restricted to owners")
+	}
+
+	exec := &ExecPlugin{PluginName: "fortune"}
+	if resp := p.Process(context.Background(), busy, "plugins: deny fortune", Discard); resp.Kind != KindError {
+		t.Errorf("expected fortune to be unknown; got %q\n", resp.Text)
+	}
+	p.SetPlugins(append(Plugins{exec}, Plugs...))
+	if resp := p.Process(context.Background(), busy, "plugins: deny fortune", Discard); resp.Kind == KindError {
+		t.Fatal(resp.Text)
+	}
+	if Allowed(store, busy, exec) {
+		t.Error("expected the exec plugin to be denied")
+	}
+}
+
+func TestPluginsWithout(t *testing.T) {
+	plugs := Plugins{&Hi{}, &Thanks{}, &Policy{}}.Without([]string{"HI", "policy"})
+	if l := plugs.List(); l != "Thanks, Policy" {
+		t.Errorf("expected 'Thanks, Policy'; got %q\n", l)
+	}
+}
@@ -0,0 +1,166 @@
+package plugins
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate is a number of messages allowed within a period, written as
+// "count/period", for example "5/1m".
+type Rate struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseRate parses a Rate, the empty string is no limit.
+func ParseRate(s string) (Rate, error) {
+	if s == "" {
+		return Rate{}, nil
+	}
+
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q, expected count/period", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return Rate{}, fmt.Errorf("invalid count in rate %q", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("invalid period in rate %q", s)
+	}
+	return Rate{Count: n, Period: d}, nil
+}
+
+// Unlimited is true for the zero Rate.
+func (r Rate) Unlimited() bool {
+	return r.Count == 0
+}
+
+func (r Rate) String() string {
+	if r.Unlimited() {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d/%s", r.Count, r.Period)
+}
+
+// bucket is a token bucket holding up to Rate.Count tokens, refilled at
+// Rate.Count per Rate.Period.
+type bucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time
+	warned bool
+}
+
+func (b *bucket) refill(r Rate, now time.Time) {
+	b.rate = r
+	b.tokens += now.Sub(b.last).Seconds() * float64(r.Count) / r.Period.Seconds()
+	b.tokens = min(b.tokens, float64(r.Count))
+	b.last = now
+}
+
+// pruneAfter is the number of buckets we keep before dropping the ones
+// that have filled up again.
+const pruneAfter = 1024
+
+// RateLimiter keeps token buckets for users, rooms and plugins. Limits
+// are read from the store on every call so they can be changed while
+// running:
+//
+//   - "ratelimit_user": messages each user can send
+//   - "ratelimit_room": messages handled in each room
+//   - "ratelimit_plugin_<name>": calls of a plugin, across all users
+//
+// A message handled by a plugin takes a token from each of the three
+// buckets. Limits that are not set are not enforced.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// NewRateLimiter creates an empty RateLimiter.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Limited is returned by RateLimiter.Take when a limit is reached. Warn is
+// true the first time a bucket runs dry, so people are only told to slow
+// down once.
+type Limited struct {
+	Key  string
+	Warn bool
+}
+
+func (l *Limited) Error() string {
+	return fmt.Sprintf("rate limit reached for %s", l.Key)
+}
+
+// Take takes a token for p handling a message from mc. It returns a
+// *Limited error if any of the buckets is empty, in which case no tokens
+// are taken.
+func (l *RateLimiter) Take(store PluginStore, mc *MessageContext, p Plugin) error {
+	user := mc.User
+	if user == "" {
+		user = Identity(mc.Chat, mc.Sender)
+	}
+	keys := []struct{ key, bucket string }{
+		{"ratelimit_user", "user:" + user},
+		{"ratelimit_room", "room:" + strings.ToLower(mc.Chat) + ":" + mc.Room},
+		{"ratelimit_plugin_" + strings.ToLower(p.Name()), "plugin:" + p.Name()},
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.buckets) > pruneAfter {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > b.rate.Period {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	var take []*bucket
+	for _, k := range keys {
+		v, _ := store.Get(k.key)
+		r, err := ParseRate(v)
+		if err != nil {
+			log.Printf("%s: %s", k.key, err)
+			continue
+		}
+		if r.Unlimited() {
+			continue
+		}
+
+		b, ok := l.buckets[k.bucket]
+		if !ok {
+			b = &bucket{tokens: float64(r.Count), last: now}
+			l.buckets[k.bucket] = b
+		}
+		b.refill(r, now)
+
+		if b.tokens < 1 {
+			warn := !b.warned
+			b.warned = true
+			return &Limited{Key: k.bucket, Warn: warn}
+		}
+		take = append(take, b)
+	}
+
+	for _, b := range take {
+		b.tokens--
+		b.warned = false
+	}
+	return nil
+}
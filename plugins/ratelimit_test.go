@@ -0,0 +1,59 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestParseRate(t *testing.T) {
+	testRates := []struct {
+		rate string
+		want Rate
+		ok   bool
+	}{
+		{"", Rate{}, true},
+		{"5/1m", Rate{5, time.Minute}, true},
+		{"1/2h30m", Rate{1, 150 * time.Minute}, true},
+		{"5", Rate{}, false},
+		{"0/1m", Rate{}, false},
+		{"5/soon", Rate{}, false},
+		{"5/-1m", Rate{}, false},
+	}
+
+	for _, tr := range testRates {
+		r, err := ParseRate(tr.rate)
+		if (err == nil) != tr.ok || r != tr.want {
+			t.Errorf("%q: expected %v (ok %t); got %v (%v)\n", tr.rate, tr.want, tr.ok, r, err)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	store := mcstoretest.Map{"ratelimit_room": "2/1m"}
+	now := time.Now()
+	l := NewRateLimiter()
+	l.now = func() time.Time { return now }
+
+	mc := &MessageContext{Chat: "IRC", Room: "#mcchunkie", Sender: "qbit"}
+	var warnings []bool
+	for range 4 {
+		var limited *Limited
+		if err := l.Take(store, mc, &Hi{}); errors.As(err, &limited) {
+			warnings = append(warnings, limited.Warn)
+		}
+	}
+	if len(warnings) != 2 || !warnings[0] || warnings[1] {
+		t.Errorf("expected two limited messages with one warning; got %v\n", warnings)
+	}
+
+	now = now.Add(30 * time.Second)
+	if err := l.Take(store, mc, &Hi{}); err != nil {
+		t.Errorf("expected a token after 30s; got %s\n", err)
+	}
+	if err := l.Take(store, mc, &Hi{}); err == nil {
+		t.Error("expected the bucket to be empty again")
+	}
+}
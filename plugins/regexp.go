@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// compiled holds the compiled form of every pattern returned by a plugin's
+// Re, and the ones built from the bot's names, so each one is only
+// compiled once.
+var compiled = struct {
+	sync.RWMutex
+	re map[string]*regexp.Regexp
+}{re: map[string]*regexp.Regexp{}}
+
+// Compile compiles and caches the regular expression of p.
+func Compile(p Plugin) (*regexp.Regexp, error) {
+	re, err := compile(p.Re())
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern %q: %w", p.Name(), p.Re(), err)
+	}
+	return re, nil
+}
+
+// compile compiles and caches pattern.
+func compile(pattern string) (*regexp.Regexp, error) {
+	compiled.RLock()
+	re, ok := compiled.re[pattern]
+	compiled.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled.Lock()
+	compiled.re[pattern] = re
+	compiled.Unlock()
+
+	return re, nil
+}
+
+// Compiled returns the cached regular expression of p. Patterns are
+// checked at startup with Plugins.Compile, so this only panics for
+// plugins that were never checked.
+func Compiled(p Plugin) *regexp.Regexp {
+	re, err := Compile(p)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// mustCompile is compile for patterns that are known to be valid, like
+// the ones quoting the bot's names.
+func mustCompile(pattern string) *regexp.Regexp {
+	re, err := compile(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// Compile compiles the regular expressions of all the plugins, returning
+// an error listing every invalid pattern.
+func (p Plugins) Compile() error {
+	var errs []error
+	for _, plg := range p {
+		if _, err := Compile(plg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Captures returns the named capture groups of re in msg. It returns nil
+// if re doesn't match.
+func Captures(re *regexp.Regexp, msg string) map[string]string {
+	matches := re.FindStringSubmatch(msg)
+	if matches == nil {
+		return nil
+	}
+
+	caps := map[string]string{}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			caps[name] = matches[i]
+		}
+	}
+	return caps
+}
@@ -0,0 +1,42 @@
+package plugins
+
+import (
+	"context"
+	"testing"
+)
+
+type badRe struct {
+	Hi
+}
+
+func (b *badRe) Re() string { return `(?P<broken` }
+
+func TestPluginsCompile(t *testing.T) {
+	if err := Plugs.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (Plugins{&Hi{}, &badRe{}}).Compile(); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+
+	if Compiled(&Hi{}) != Compiled(&Hi{}) {
+		t.Error("expected patterns to be compiled once")
+	}
+}
+
+func TestCaptures(t *testing.T) {
+	caps := Captures(Compiled(&Remind{}), "remind: 5m take out the trash")
+	if caps["duration"] != "5m" || caps["reminder"] != "take out the trash" {
+		t.Errorf("unexpected captures: %q\n", caps)
+	}
+
+	if caps := Captures(Compiled(&Remind{}), "nope"); caps != nil {
+		t.Errorf("expected nil; got %q\n", caps)
+	}
+
+	resp := (&Remind{}).Process(context.Background(), &MessageContext{Captures: caps}, "", Discard)
+	if resp.Kind == KindError {
+		t.Error(resp.Text)
+	}
+}
@@ -0,0 +1,238 @@
+package plugins
+
+import (
+	"context"
+	"encoding/base32"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRelayRe matches messages relayed as "<sender> text".
+const DefaultRelayRe = `^<(?P<sender>[^>]+)> (?P<text>.*)$`
+
+// DefaultBridgeWindow is how long a message is remembered to spot it
+// coming in again over a bridge, it can be changed with "bridge_window".
+const DefaultBridgeWindow = 10 * time.Second
+
+// Unrelay handles messages from relay bots, bots that pass on messages
+// from other networks. Relay bots are listed in "relay_bots", entries are
+// "chat:id" or just "id" like in the ACL. Their messages are matched
+// against "relay_re" (or "relay_re_<chat>", DefaultRelayRe if neither is
+// set), the "sender" and "text" groups are who really sent the message and
+// what they said. mc is changed to describe the real sender.
+//
+// The real sender can't be checked, so their identity is
+// "relay:<bot>:<sender>", never the one they have here, and they are
+// Unverified: whatever name the relay bot shows, nobody gets the roles of
+// a local user that way. To ignore someone behind a relay bot, ignore
+// "relay:<bot>:<sender>".
+//
+// Messages relay bots send themselves, and our own messages relayed back,
+// are ignored and Unrelay returns false.
+func Unrelay(store PluginStore, mc *MessageContext, msg string) (string, bool) {
+	if !slices.ContainsFunc(List(store, "relay_bots"), func(e string) bool {
+		return aclMatch(e, mc)
+	}) {
+		return msg, true
+	}
+
+	expr := setting(store, "relay_re", mc.Chat)
+	if expr == "" {
+		expr = DefaultRelayRe
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		log.Printf("%s: invalid relay_re: %s", mc.Chat, err)
+		return msg, false
+	}
+
+	caps := Captures(re, msg)
+	if !re.MatchString(msg) || caps["sender"] == "" {
+		return msg, false
+	}
+	if hasName(mc.names(), caps["sender"]) {
+		return msg, false
+	}
+
+	mc.RelayedBy = mc.Sender
+	mc.Sender = fmt.Sprintf("relay:%s:%s", mc.RelayedBy, caps["sender"])
+	mc.DisplayName = caps["sender"]
+	mc.User = ""
+	mc.Unverified = true
+	return caps["text"], true
+}
+
+// ignoreKey returns the key of the ignore list of mc.Room,
+// "ignore_<chat>_<base32 room>".
+func ignoreKey(mc *MessageContext) string {
+	return fmt.Sprintf("ignore_%s_%s", strings.ToLower(mc.Chat), base32.StdEncoding.EncodeToString([]byte(mc.Room)))
+}
+
+// Ignored reports whether the sender of mc is on the ignore list of the
+// room, the chat ("ignore_<chat>") or everywhere ("ignore"). Entries are
+// "chat:id" or "id" like in the ACL.
+func Ignored(store PluginStore, mc *MessageContext) bool {
+	for _, key := range []string{ignoreKey(mc), "ignore_" + strings.ToLower(mc.Chat), "ignore"} {
+		if slices.ContainsFunc(List(store, key), func(e string) bool {
+			return aclMatch(e, mc)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ignore adds id to the ignore list of the room of mc.
+func Ignore(store PluginStore, mc *MessageContext, id string) error {
+	return AddToSet(store, ignoreKey(mc), id)
+}
+
+// Unignore removes id from the ignore list of the room of mc.
+func Unignore(store PluginStore, mc *MessageContext, id string) error {
+	return RemoveFromList(store, ignoreKey(mc), id)
+}
+
+// Bridges remembers recent messages from bridged rooms, so a message that
+// arrives in more than one of them is only answered once. Bridged rooms
+// are listed in "bridges": groups of "chat:room" entries separated by
+// spaces, groups separated by commas, for example
+// "irc:#mcchunkie matrix:!abc:tapenet.org".
+type Bridges struct {
+	Window time.Duration
+
+	mu   sync.Mutex
+	seen map[string]seen
+	now  func() time.Time
+}
+
+// seen is where and when a message was seen.
+type seen struct {
+	room string
+	at   time.Time
+}
+
+// NewBridges creates a Bridges that remembers messages for window.
+func NewBridges(window time.Duration) *Bridges {
+	return &Bridges{
+		Window: window,
+		seen:   map[string]seen{},
+		now:    time.Now,
+	}
+}
+
+// group returns the bridge group mc.Room belongs to, -1 if it isn't
+// bridged.
+func group(store PluginStore, mc *MessageContext) int {
+	for i, g := range List(store, "bridges") {
+		for _, room := range strings.Fields(g) {
+			chat, id, ok := strings.Cut(room, ":")
+			if ok && strings.EqualFold(chat, mc.Chat) && id == mc.Room {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Duplicate reports whether msg, from the sender of mc, just came in from
+// another room bridged with mc.Room. Senders are compared by name, bridges
+// usually keep those.
+func (b *Bridges) Duplicate(store PluginStore, mc *MessageContext, msg string) bool {
+	g := group(store, mc)
+	if g < 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	for k, s := range b.seen {
+		if now.Sub(s.at) > b.Window {
+			delete(b.seen, k)
+		}
+	}
+
+	room := Identity(mc.Chat, mc.Room)
+	name := strings.ToLower(NameRE.ReplaceAllString(mc.Name(), "$1"))
+	key := fmt.Sprintf("%d %s %s", g, name, strings.TrimSpace(msg))
+	if s, ok := b.seen[key]; ok && s.room != room {
+		return true
+	}
+	b.seen[key] = seen{room: room, at: now}
+	return false
+}
+
+// Ignorer lets owners manage the ignore list of a room from chat.
+type Ignorer struct {
+	db PluginStore
+}
+
+// Descr describes this plugin
+func (p *Ignorer) Descr() string {
+	return "Ignore people (or bots) in a room. IDs can be limited to a chat with `chat:id`. Owners only."
+}
+
+// Re matches our ignore commands
+func (p *Ignorer) Re() string {
+	return `(?i)^ignore: (?P<cmd>add|remove|show) ?(?P<id>\S*)$`
+}
+
+// Match checks for "ignore: " messages
+func (p *Ignorer) Match(_ *MessageContext, msg string) bool {
+	return Compiled(p).MatchString(msg)
+}
+
+// Essential keeps the ignore list manageable in every room
+func (p *Ignorer) Essential() bool {
+	return true
+}
+
+// Role restricts Ignorer to owners
+func (p *Ignorer) Role() Role {
+	return RoleOwner
+}
+
+// Privileged gives Ignorer the main store, it manages ignore lists
+func (p *Ignorer) Privileged() bool {
+	return true
+}
+
+// SetStore sets the store
+func (p *Ignorer) SetStore(s PluginStore) {
+	p.db = s
+}
+
+// Process adds, removes or shows ignored people
+func (p *Ignorer) Process(_ context.Context, mc *MessageContext, _ string, _ Emitter) *Response {
+	cmd, id := strings.ToLower(mc.Captures["cmd"]), mc.Captures["id"]
+
+	if cmd == "show" {
+		return Text(fmt.Sprintf("ignoring: %q", List(p.db, ignoreKey(mc))))
+	}
+
+	if id == "" {
+		return Errorf("sorry %s, I need someone to %s", mc.Name(), cmd)
+	}
+
+	if cmd == "remove" {
+		if err := Unignore(p.db, mc, id); err != nil {
+			return Error(err)
+		}
+		return Text(fmt.Sprintf("no longer ignoring %s here", id))
+	}
+	if err := Ignore(p.db, mc, id); err != nil {
+		return Error(err)
+	}
+	return Text(fmt.Sprintf("ignoring %s here", id))
+}
+
+// Name Ignore
+func (p *Ignorer) Name() string {
+	return "Ignore"
+}
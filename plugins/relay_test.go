@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestUnrelay(t *testing.T) {
+	store := mcstoretest.Map{
+		"relay_bots":      "irc:tapebot,bridge",
+		"relay_re_matrix": `^\[(?P<sender>\w+)\] (?P<text>.*)$`,
+	}
+	testMsgs := []struct {
+		chat, sender, msg string
+		from, want        string
+		ok                bool
+	}{
+		{"IRC", "qbit", "<other> hi", "qbit", "<other> hi", true},
+		{"IRC", "tapebot", "<qbit> hi", "relay:tapebot:qbit", "hi", true},
+		{"IRC", "tapebot", "qbit joined", "tapebot", "qbit joined", false},
+		{"IRC", "tapebot", "<mcchunkie> hi qbit", "tapebot", "<mcchunkie> hi qbit", false},
+		{"XMPP", "tapebot", "<qbit> hi", "tapebot", "<qbit> hi", true},
+		{"Matrix", "bridge", "[qbit] botsnack", "relay:bridge:qbit", "botsnack", true},
+		{"Matrix", "bridge", "<qbit> botsnack", "bridge", "<qbit> botsnack", false},
+	}
+
+	for _, tm := range testMsgs {
+		mc := &MessageContext{Chat: tm.chat, Sender: tm.sender, BotName: "mcchunkie"}
+		msg, ok := Unrelay(store, mc, tm.msg)
+		if msg != tm.want || mc.Sender != tm.from || ok != tm.ok {
+			t.Errorf("%s %s %q: expected %q from %q (%t); got %q from %q (%t)\n", tm.chat, tm.sender, tm.msg, tm.want, tm.from, tm.ok, msg, mc.Sender, ok)
+		}
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	store := mcstoretest.Map{"ignore_irc": "otherbot", "ignore": "sms:+15551234567"}
+	Ignore(store, &MessageContext{Chat: "Matrix", Room: "!room"}, "@bot:tapenet.org")
+	Ignore(store, &MessageContext{Chat: "Matrix", Room: "!room"}, "@spam:tapenet.org")
+	Unignore(store, &MessageContext{Chat: "Matrix", Room: "!room"}, "@spam:tapenet.org")
+
+	testIgnores := []struct {
+		mc      *MessageContext
+		ignored bool
+	}{
+		{&MessageContext{Chat: "IRC", Room: "#test", Sender: "otherbot"}, true},
+		{&MessageContext{Chat: "IRC", Room: "#test", Sender: "qbit"}, false},
+		{&MessageContext{Chat: "SMS", Room: "+15551234567", Sender: "+15551234567"}, true},
+		{&MessageContext{Chat: "Matrix", Room: "!room", Sender: "@bot:tapenet.org"}, true},
+		{&MessageContext{Chat: "Matrix", Room: "!other", Sender: "@bot:tapenet.org"}, false},
+		{&MessageContext{Chat: "Matrix", Room: "!room", Sender: "@spam:tapenet.org"}, false},
+	}
+
+	for _, ti := range testIgnores {
+		if Ignored(store, ti.mc) != ti.ignored {
+			t.Errorf("%s %s %s: expected ignored to be %t\n", ti.mc.Chat, ti.mc.Room, ti.mc.Sender, ti.ignored)
+		}
+	}
+}
+
+func TestBridges(t *testing.T) {
+	store := mcstoretest.Map{"bridges": "irc:#test matrix:!room:tapenet.org, irc:#other"}
+	now := time.Now()
+	b := NewBridges(time.Minute)
+	b.now = func() time.Time { return now }
+
+	irc := &MessageContext{Chat: "IRC", Room: "#test", Sender: "qbit"}
+	matrix := &MessageContext{Chat: "Matrix", Room: "!room:tapenet.org", Sender: "@qbit:tapenet.org"}
+	other := &MessageContext{Chat: "IRC", Room: "#other", Sender: "qbit"}
+	unbridged := &MessageContext{Chat: "IRC", Room: "#unbridged", Sender: "qbit"}
+
+	testMsgs := []struct {
+		mc        *MessageContext
+		msg       string
+		after     time.Duration
+		duplicate bool
+	}{
+		{irc, "hi", 0, false},
+		{matrix, "hi", 0, true},
+		{other, "hi", 0, false},
+		{unbridged, "hi", 0, false},
+		{irc, "hi", 0, false},
+		{matrix, "botsnack", 0, false},
+		{irc, "botsnack", 0, true},
+		{matrix, "hi", 2 * time.Minute, false},
+	}
+
+	for i, tm := range testMsgs {
+		now = now.Add(tm.after)
+		if b.Duplicate(store, tm.mc, tm.msg) != tm.duplicate {
+			t.Errorf("%d: %s %s %q: expected duplicate to be %t\n", i, tm.mc.Chat, tm.mc.Room, tm.msg, tm.duplicate)
+		}
+	}
+}
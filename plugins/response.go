@@ -0,0 +1,137 @@
+package plugins
+
+import (
+	"fmt"
+)
+
+// Kind describes what a Response carries and how a chat should present it.
+type Kind int
+
+const (
+	// KindText is plain text.
+	KindText Kind = iota
+	// KindMarkdown is text containing markdown formatting.
+	KindMarkdown
+	// KindNotice is a markdown notice. Chats that distinguish notices from
+	// regular messages (Matrix m.notice, IRC NOTICE) should use them.
+	KindNotice
+	// KindEmote is an action performed by the bot, like IRC's "/me".
+	KindEmote
+	// KindImage carries PNG data in Image. Text is used as a description
+	// for chats that can't display images.
+	KindImage
+	// KindReaction reacts to the message that triggered the plugin. Text
+	// holds the reaction (typically an emoji).
+	KindReaction
+	// KindError is an error that should be shown to the user.
+	KindError
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindText:
+		return "text"
+	case KindMarkdown:
+		return "markdown"
+	case KindNotice:
+		return "notice"
+	case KindEmote:
+		return "emote"
+	case KindImage:
+		return "image"
+	case KindReaction:
+		return "reaction"
+	case KindError:
+		return "error"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// MarshalText encodes k as its name.
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes the name of a Kind. An empty name is KindText.
+func (k *Kind) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*k = KindText
+		return nil
+	}
+	for kind := KindText; kind <= KindError; kind++ {
+		if kind.String() == string(b) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown kind %q", b)
+}
+
+// Response is what a plugin hands back to a chat. Chats render it the best
+// way they can. A nil *Response means there is nothing to send.
+type Response struct {
+	Kind  Kind   `json:"kind"`
+	Text  string `json:"text"`
+	Image []byte `json:"image,omitempty"`
+	// Edit is the ID of an earlier message this one replaces, for chats
+	// that can edit messages (see Emitter).
+	Edit string `json:"edit,omitempty"`
+}
+
+// Text creates a plain text response.
+func Text(s string) *Response {
+	return &Response{Kind: KindText, Text: s}
+}
+
+// Markdown creates a markdown response.
+func Markdown(s string) *Response {
+	return &Response{Kind: KindMarkdown, Text: s}
+}
+
+// Notice creates a markdown notice.
+func Notice(s string) *Response {
+	return &Response{Kind: KindNotice, Text: s}
+}
+
+// Emote creates an emote response.
+func Emote(s string) *Response {
+	return &Response{Kind: KindEmote, Text: s}
+}
+
+// Image creates an image response from PNG data. alt describes the image.
+func Image(png []byte, alt string) *Response {
+	return &Response{Kind: KindImage, Text: alt, Image: png}
+}
+
+// Reaction creates a reaction to the triggering message.
+func Reaction(key string) *Response {
+	return &Response{Kind: KindReaction, Text: key}
+}
+
+// Error creates a response for an error that is meant for the user.
+func Error(err error) *Response {
+	return &Response{Kind: KindError, Text: err.Error()}
+}
+
+// Errorf formats an error that is meant for the user.
+func Errorf(format string, a ...any) *Response {
+	return &Response{Kind: KindError, Text: fmt.Sprintf(format, a...)}
+}
+
+// String returns a plain text rendering of the response. Chats without
+// support for a given Kind can fall back to this.
+func (r *Response) String() string {
+	if r == nil {
+		return ""
+	}
+	switch r.Kind {
+	case KindEmote:
+		return fmt.Sprintf("* %s", r.Text)
+	}
+	return r.Text
+}
+
+// Empty reports whether there is nothing to send.
+func (r *Response) Empty() bool {
+	return r == nil || (r.Text == "" && len(r.Image) == 0)
+}
@@ -1,10 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // RFC sends rfc urls when someone references an rfc
@@ -22,8 +20,8 @@ func (h *RFC) Re() string {
 }
 
 // Match checks for our man page re
-func (h *RFC) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *RFC) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
@@ -31,20 +29,14 @@ func (h *RFC) Match(_, msg string) bool {
 func (h *RFC) SetStore(_ PluginStore) {}
 
 // Process does the heavy lifting
-func (h *RFC) Process(from, post string) (string, func() string) {
-	re := regexp.MustCompile(h.Re())
+func (h *RFC) Process(_ context.Context, _ *MessageContext, post string, _ Emitter) *Response {
+	re := Compiled(h)
 	rfcNum := re.ReplaceAllString(post, "$1")
 	if rfcNum != "" {
-		return fmt.Sprintf("https://tools.ietf.org/html/rfc%s", rfcNum), RespStub
+		return Text(fmt.Sprintf("https://tools.ietf.org/html/rfc%s", rfcNum))
 	}
 
-	return "that's not an RFC.", RespStub
-}
-
-// RespondText sends back a man page.
-func (h *RFC) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendText(c, ev.RoomID, resp)
+	return Text("that's not an RFC.")
 }
 
 // Name RFC
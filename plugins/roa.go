@@ -1,10 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"math/rand"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // ROA sends a random rule
@@ -22,8 +20,8 @@ func (h *ROA) Re() string {
 }
 
 // Match determines if we are asking for an roa
-func (h *ROA) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *ROA) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
@@ -31,7 +29,7 @@ func (h *ROA) Match(user, msg string) bool {
 func (h *ROA) SetStore(_ PluginStore) {}
 
 // Process
-func (h *ROA) Process(from, post string) (string, func() string) {
+func (h *ROA) Process(_ context.Context, _ *MessageContext, post string, _ Emitter) *Response {
 	a := []string{
 		`1	Once you have their money, you never give it back.`,
 		`2	The best deal is the one that brings the most profit.`,
@@ -138,13 +136,7 @@ func (h *ROA) Process(from, post string) (string, func() string) {
 		`-	If that's what's written, then that's what's written.`,
 	}
 
-	return a[rand.Intn(len(a))], RespStub
-}
-
-// RespondText
-func (h *ROA) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, _ string) error {
-	resp, _ := h.Process(ev.Sender, "")
-	return SendText(c, ev.RoomID, resp)
+	return Text(a[rand.Intn(len(a))])
 }
 
 // Name ROA
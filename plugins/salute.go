@@ -1,10 +1,9 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Salute high fives!
@@ -15,6 +14,8 @@ func rightSalute() string {
 	return "o7"
 }
 
+var rightSaluteRE = regexp.MustCompile(rightSalute())
+
 // Descr describes this plugin
 func (h *Salute) Descr() string {
 	return "Everyone loves Salutes."
@@ -29,27 +30,19 @@ func (h *Salute) Re() string {
 func (h *Salute) SetStore(_ PluginStore) {}
 
 // Match determines if we should bother giving a salute
-func (h *Salute) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
-	return ToMe(user, msg) && re.MatchString(msg)
+func (h *Salute) Match(mc *MessageContext, msg string) bool {
+	re := Compiled(h)
+	return mc.ToMe(msg) && re.MatchString(msg)
 }
 
-func (h *Salute) Process(from, post string) (string, func() string) {
-	s := NameRE.ReplaceAllString(from, "$1")
-
-	rm := regexp.MustCompile(rightSalute())
+func (h *Salute) Process(_ context.Context, mc *MessageContext, post string, _ Emitter) *Response {
+	s := mc.Name()
 
-	if rm.MatchString(post) {
-		return fmt.Sprintf("%s o7", s), RespStub
+	if rightSaluteRE.MatchString(post) {
+		return Text(fmt.Sprintf("%s o7", s))
 	}
 
-	return "o7", RespStub
-}
-
-// RespondText to high five events
-func (h *Salute) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendText(c, ev.RoomID, resp)
+	return Text("o7")
 }
 
 // Name returns the name of the Salute plugin
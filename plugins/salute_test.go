@@ -13,7 +13,7 @@ func TestSaluteMatch(t *testing.T) {
 
 	h := &Salute{}
 	for msg, should := range testStrings {
-		if h.Match("", msg) != should {
+		if h.Match(&MessageContext{}, msg) != should {
 			t.Errorf("Salute expected to match %q (%t); but doesn't\n", msg, should)
 		}
 	}
@@ -0,0 +1,111 @@
+package plugins
+
+import (
+	"encoding/base32"
+	"fmt"
+	"strings"
+)
+
+// Privileged is implemented by plugins that manage the bot itself, like
+// Roles and Policy. They get the main store, every other plugin gets a
+// Scope.
+type Privileged interface {
+	Privileged() bool
+}
+
+// Configured is implemented by plugins that read settings from the main
+// store. Settings returns the keys they may read, keys ending in "*" are
+// prefixes.
+type Configured interface {
+	Settings() []string
+}
+
+// storeBucket is a PluginStore keeping its keys apart from the rest of
+// store by prefixing them with "<name>/". MCStore keeps those in a bucket
+// of their own (see mcstore.MCStore.Bucket).
+type storeBucket struct {
+	store PluginStore
+	name  string
+}
+
+// Bucket returns the bucket called name of store.
+func Bucket(store PluginStore, name string) PluginStore {
+	return &storeBucket{store: store, name: name}
+}
+
+func (b *storeBucket) Set(key, value string) error {
+	return b.store.Set(b.name+"/"+key, value)
+}
+
+func (b *storeBucket) Get(key string) (string, error) {
+	return b.store.Get(b.name + "/" + key)
+}
+
+func (b *storeBucket) Update(key string, fn func(string) (string, error)) error {
+	return Update(b.store, b.name+"/"+key, fn)
+}
+
+// Scope is the store of a single plugin. What the plugin sets is kept in
+// its own bucket, "plugins/<name>". Besides that the plugin can read the
+// settings it asked for (see Configured) from the main store, but nothing
+// else, so it can't get at credentials of chats or other plugins.
+type Scope struct {
+	Bucket   PluginStore
+	Main     PluginStore
+	Settings []string
+}
+
+// Scoped returns the store to give to p: store itself for Privileged
+// plugins, a Scope for everything else.
+func Scoped(store PluginStore, p Plugin) PluginStore {
+	if pr, ok := p.(Privileged); ok && pr.Privileged() {
+		return store
+	}
+	s := &Scope{
+		Bucket: Bucket(Bucket(store, "plugins"), strings.ToLower(p.Name())),
+		Main:   store,
+	}
+	if c, ok := p.(Configured); ok {
+		s.Settings = c.Settings()
+	}
+	return s
+}
+
+// Readable reports whether key is one of the settings of the plugin. Per
+// user keys (see UserKey) are checked by their decoded name.
+func (s *Scope) Readable(key string) bool {
+	keys := []string{key}
+	if b, err := base32.StdEncoding.DecodeString(key); err == nil {
+		keys = append(keys, string(b))
+	}
+	for _, k := range keys {
+		for _, setting := range s.Settings {
+			if prefix, ok := strings.CutSuffix(setting, "*"); ok && strings.HasPrefix(k, prefix) || k == setting {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Set sets key in the plugin's bucket.
+func (s *Scope) Set(key, value string) error {
+	return s.Bucket.Set(key, value)
+}
+
+// Update updates key in the plugin's bucket.
+func (s *Scope) Update(key string, fn func(string) (string, error)) error {
+	return Update(s.Bucket, key, fn)
+}
+
+// Get returns key from the plugin's bucket, or from the main store if it is
+// one of the plugin's settings.
+func (s *Scope) Get(key string) (string, error) {
+	if v, err := s.Bucket.Get(key); err == nil && v != "" {
+		return v, nil
+	}
+	if s.Readable(key) {
+		return s.Main.Get(key)
+	}
+	return "", fmt.Errorf("no entry for %q", key)
+}
@@ -0,0 +1,47 @@
+package plugins
+
+import (
+	"encoding/base32"
+	"testing"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestScope(t *testing.T) {
+	store := mcstoretest.Map{
+		"matrix_access_token": "secret",
+		"weather_api_key":     "weather",
+		"acl_owner":           "qbit",
+		base32.StdEncoding.EncodeToString([]byte("simple_login_api_irc:qbit")): "alias",
+	}
+
+	weather := Scoped(store, &Weather{})
+	simple := Scoped(store, &Simple{})
+	roles := Scoped(store, &Roles{})
+
+	weather.Set("last", "12345")
+	if store["plugins/weather/last"] != "12345" {
+		t.Errorf("expected weather to write to its bucket; got %q\n", store)
+	}
+
+	testGets := []struct {
+		store PluginStore
+		key   string
+		want  string
+	}{
+		{weather, "weather_api_key", "weather"},
+		{weather, "matrix_access_token", ""},
+		{weather, "acl_owner", ""},
+		{weather, "last", "12345"},
+		{simple, "last", ""},
+		{simple, base32.StdEncoding.EncodeToString([]byte("simple_login_api_irc:qbit")), "alias"},
+		{simple, "weather_api_key", ""},
+		{roles, "acl_owner", "qbit"},
+	}
+
+	for _, tg := range testGets {
+		if v, _ := tg.store.Get(tg.key); v != tg.want {
+			t.Errorf("%q: expected %q; got %q\n", tg.key, tg.want, v)
+		}
+	}
+}
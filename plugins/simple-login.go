@@ -1,14 +1,11 @@
 package plugins
 
 import (
+	"context"
 	"encoding/base32"
 	"fmt"
-	"log"
 	"net/url"
-	"regexp"
 	"time"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // SimpleResp is a JSON response from OpenSimpleMap.org
@@ -48,6 +45,11 @@ type Simple struct {
 	db PluginStore
 }
 
+// Settings lets Simple read the API keys of users
+func (h *Simple) Settings() []string {
+	return []string{"simple_login_api_*"}
+}
+
 // SetStore is the setup function for a plugin
 func (h *Simple) SetStore(s PluginStore) {
 	h.db = s
@@ -64,30 +66,32 @@ func (h *Simple) Re() string {
 }
 
 // Match checks for "simple-login: " messages
-func (h *Simple) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Simple) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
 func (h *Simple) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	return re.ReplaceAllString(msg, "$1")
 }
 
-func (h *Simple) Process(from, post string) (string, func() string) {
+func (h *Simple) Process(ctx context.Context, mc *MessageContext, post string, _ Emitter) *Response {
 	reqInfo := h.fix(post)
 	if reqInfo != "" {
-		userKey := fmt.Appendf(nil, "simple_login_api_%s", from)
-		userFile := base32.StdEncoding.EncodeToString(userKey)
-		log.Println(userFile)
-		userAPIKey, err := h.db.Get(userFile)
+		userAPIKey, err := h.db.Get(UserKey(mc, "simple_login_api"))
 		if err != nil {
-			return fmt.Sprintf("sorry %s, looks like you can't make aliases!", from), RespStub
+			// Keys set up before linking existed are per chat identity.
+			userKey := fmt.Appendf(nil, "simple_login_api_%s", mc.Sender)
+			userAPIKey, err = h.db.Get(base32.StdEncoding.EncodeToString(userKey))
+		}
+		if err != nil {
+			return Errorf("sorry %s, looks like you can't make aliases!", mc.Name())
 		}
 
 		reqURL, err := url.Parse("https://app.simplelogin.io/api/alias/random/new/")
 		if err != nil {
-			return fmt.Sprintf("sorry %s, invalid URL: %s", from, err), RespStub
+			return Errorf("sorry %s, invalid URL: %s", mc.Name(), err)
 		}
 		v := url.Values{}
 		v.Add("hostname", reqInfo)
@@ -95,6 +99,7 @@ func (h *Simple) Process(from, post string) (string, func() string) {
 
 		var resp = &SimpleResp{}
 		var req = HTTPRequest{
+			Context: ctx,
 			Timeout: 15 * time.Second,
 			URL:     reqURL.String(),
 			Method:  "POST",
@@ -105,18 +110,12 @@ func (h *Simple) Process(from, post string) (string, func() string) {
 		}
 		err = req.DoJSON()
 		if err != nil {
-			return fmt.Sprintf("sorry %s, I can't hit the simple-login API. %s", from, err), RespStub
+			return Errorf("sorry %s, I can't hit the simple-login API. %s", mc.Name(), err)
 		}
-		return resp.Email, RespStub
+		return Text(resp.Email)
 	}
 
-	return "shrug.", RespStub
-}
-
-// RespondText to looking up of simple-login lookup requests
-func (h *Simple) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendText(c, ev.RoomID, resp)
+	return Text("shrug.")
 }
 
 // Name Simple!
@@ -1,13 +1,10 @@
 package plugins
 
 import (
+	"context"
 	"io"
-	"net/http"
-	"regexp"
 	"strings"
 	"time"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Snap responds to OpenBSD snapshot checks
@@ -25,8 +22,8 @@ func (p *Snap) Re() string {
 }
 
 // Match determines if we should call the response for Snap
-func (p *Snap) Match(_, msg string) bool {
-	re := regexp.MustCompile(p.Re())
+func (p *Snap) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(p)
 	return re.MatchString(msg)
 }
 
@@ -34,56 +31,50 @@ func (p *Snap) Match(_, msg string) bool {
 func (p *Snap) SetStore(_ PluginStore) {}
 
 // Process does the heavy lifting
-func (p *Snap) Process(from, post string) (string, func() string) {
-	snapResp, err := http.Get("https://ftp.usa.openbsd.org/pub/OpenBSD/snapshots/amd64/BUILDINFO")
+func (p *Snap) Process(ctx context.Context, _ *MessageContext, post string, _ Emitter) *Response {
+	snapResp, err := httpGet(ctx, "https://ftp.usa.openbsd.org/pub/OpenBSD/snapshots/amd64/BUILDINFO")
 	if err != nil {
-		return err.Error(), RespStub
+		return Error(err)
 	}
 	defer snapResp.Body.Close()
 
 	buildBody, err := io.ReadAll(snapResp.Body)
 	if err != nil {
-		return err.Error(), RespStub
+		return Error(err)
 	}
 
 	str := string(buildBody)
 	parts := strings.Split(str, " - ")
 	if len(parts) != 2 {
-		return "Can't parse BUILDINFO", RespStub
+		return Text("Can't parse BUILDINFO")
 	}
 
 	snapDate, err := time.Parse(time.UnixDate, strings.TrimSpace(parts[1]))
 	if err != nil {
-		return err.Error(), RespStub
+		return Error(err)
 	}
 
-	pkgResp, err := http.Get("https://ftp3.usa.openbsd.org/pub/OpenBSD/snapshots/packages/amd64/SHA256")
+	pkgResp, err := httpGet(ctx, "https://ftp3.usa.openbsd.org/pub/OpenBSD/snapshots/packages/amd64/SHA256")
 	if err != nil {
-		return err.Error(), RespStub
+		return Error(err)
 	}
 	defer pkgResp.Body.Close()
 
 	lm := strings.TrimSpace(pkgResp.Header.Get("last-modified"))
 	if lm == "" {
-		return "Missing last-modified for SHA256", RespStub
+		return Text("Missing last-modified for SHA256")
 	}
 
 	pkgDate, err := time.Parse(time.RFC1123, lm)
 	if lm == "" {
-		return err.Error(), RespStub
+		return Error(err)
 	}
 
 	if pkgDate.Before(snapDate) {
-		return "🔴: packages are behind snapshots. It is likely not safe to update currently!", RespStub
+		return Text("🔴: packages are behind snapshots. It is likely not safe to update currently!")
 	}
 
-	return "🟢:' It is safe to update your snapshot and packages!", RespStub
-}
-
-// RespondText to looking up of federation check requests
-func (p *Snap) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, _ string) error {
-	resp, _ := p.Process("", "")
-	return SendText(c, ev.RoomID, resp)
+	return Text("🟢:' It is safe to update your snapshot and packages!")
 }
 
 // Name Snap!
@@ -1,12 +1,10 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"net/url"
-	"regexp"
 	"time"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 type SongwhipReq struct {
@@ -65,13 +63,13 @@ func (s *Songwhip) Re() string {
 }
 
 func (s *Songwhip) fix(msg string) string {
-	re := regexp.MustCompile(s.Re())
+	re := Compiled(s)
 	return re.ReplaceAllString(msg, "$1")
 }
 
 // Match determines if we should call the response for Songwhip
-func (s *Songwhip) Match(_, msg string) bool {
-	re := regexp.MustCompile(s.Re())
+func (s *Songwhip) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(s)
 	return re.MatchString(msg)
 }
 
@@ -86,17 +84,18 @@ func hasService(s string, enabled bool) string {
 	return fmt.Sprintf("%s 🇽", s)
 }
 
-func (s *Songwhip) Process(from, post string) (string, func() string) {
+func (s *Songwhip) Process(ctx context.Context, mc *MessageContext, post string, _ Emitter) *Response {
 	musicURL := s.fix(post)
 	if musicURL != "" {
 		_, err := url.ParseRequestURI(musicURL)
 		if err != nil {
-			return fmt.Sprintf("Please don't abuse this free service. that's not a real url: %q", musicURL), RespStub
+			return Markdown(fmt.Sprintf("Please don't abuse this free service. that's not a real url: %q", musicURL))
 		}
 
 		var swresp = &SongwhipResp{}
 
 		var req = HTTPRequest{
+			Context: ctx,
 			Timeout: 20 * time.Second,
 			URL:     "https://songwhip.com/",
 			Method:  "POST",
@@ -108,10 +107,10 @@ func (s *Songwhip) Process(from, post string) (string, func() string) {
 		err = req.DoJSON()
 
 		if err != nil {
-			return fmt.Sprintf("sorry %s, I can't look up that link on songwhip (%q)", from, err), RespStub
+			return Errorf("sorry %s, I can't look up that link on songwhip (%q)", mc.Name(), err)
 		}
 
-		return fmt.Sprintf("[%s](%s) (%s) can be found on: %s, %s, %s, %s",
+		return Markdown(fmt.Sprintf("[%s](%s) (%s) can be found on: %s, %s, %s, %s",
 			swresp.Name,
 			swresp.URL,
 			swresp.Type,
@@ -119,15 +118,9 @@ func (s *Songwhip) Process(from, post string) (string, func() string) {
 			hasService("Spotify", swresp.Links.Spotify),
 			hasService("Tidal", swresp.Links.Tidal),
 			hasService("YTMusic", swresp.Links.YoutubeMusic),
-		), RespStub
+		))
 	}
-	return "invalid hostname", RespStub
-}
-
-// RespondText to looking up of federation check requests
-func (s *Songwhip) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := s.Process(ev.Sender, post)
-	return SendMD(c, ev.RoomID, resp)
+	return Markdown("invalid hostname")
 }
 
 // Name Songwhip!
@@ -1,10 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Source responds to source requests
@@ -22,24 +20,18 @@ func (h *Source) Re() string {
 }
 
 // Match determines if someone is asking about the source code
-func (h *Source) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
-	return re.MatchString(msg) && ToMe(user, msg)
+func (h *Source) Match(mc *MessageContext, msg string) bool {
+	re := Compiled(h)
+	return re.MatchString(msg) && mc.ToMe(msg)
 }
 
 // SetStore does nothing in here
 func (h *Source) SetStore(_ PluginStore) {}
 
 // Process does the heavy lifting
-func (h *Source) Process(from, post string) (string, func() string) {
-	s := NameRE.ReplaceAllString(from, "$1")
-	return fmt.Sprintf("%s: %s ;D", s, "https://git.sr.ht/~qbit/mcchunkie"), RespStub
-}
-
-// RespondText to questions about TheSource™©®⑨
-func (h *Source) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, _ string) error {
-	resp, _ := h.Process(ev.Sender, "")
-	return SendText(c, ev.RoomID, resp)
+func (h *Source) Process(_ context.Context, mc *MessageContext, post string, _ Emitter) *Response {
+	s := mc.Name()
+	return Text(fmt.Sprintf("%s: %s ;D", s, "https://git.sr.ht/~qbit/mcchunkie"))
 }
 
 // Name Source
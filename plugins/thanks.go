@@ -1,11 +1,9 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Thanks responds to thanks
@@ -23,17 +21,17 @@ func (h *Thanks) Re() string {
 }
 
 // Match determines if we are being thanked
-func (h *Thanks) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
-	return re.MatchString(msg) && ToMe(user, msg)
+func (h *Thanks) Match(mc *MessageContext, msg string) bool {
+	re := Compiled(h)
+	return re.MatchString(msg) && mc.ToMe(msg)
 }
 
 // SetStore we don't need a store here
 func (h *Thanks) SetStore(_ PluginStore) {}
 
 // Process
-func (h *Thanks) Process(from, post string) (string, func() string) {
-	s := NameRE.ReplaceAllString(from, "$1")
+func (h *Thanks) Process(_ context.Context, mc *MessageContext, post string, _ Emitter) *Response {
+	s := mc.Name()
 	a := []string{
 		fmt.Sprintf("welcome %s", s),
 		"welcome",
@@ -42,13 +40,7 @@ func (h *Thanks) Process(from, post string) (string, func() string) {
 		fmt.Sprintf("you're welcome, %s", s),
 	}
 
-	return a[rand.Intn(len(a))], RespStub
-}
-
-// RespondText to welcome back events
-func (h *Thanks) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, _ string) error {
-	resp, _ := h.Process(ev.Sender, "")
-	return SendText(c, ev.RoomID, resp)
+	return Text(a[rand.Intn(len(a))])
 }
 
 // Name Thanks
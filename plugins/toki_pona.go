@@ -1,12 +1,12 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/caneroj1/stemmer"
-	"github.com/matrix-org/gomatrix"
 )
 
 // Toki responds to toki pona word queries
@@ -4022,8 +4022,8 @@ func (t *Toki) Re() string {
 }
 
 // Match determines if we are highfiving
-func (t *Toki) Match(_, msg string) bool {
-	re := regexp.MustCompile(t.Re())
+func (t *Toki) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(t)
 	return re.MatchString(msg)
 }
 
@@ -4031,12 +4031,12 @@ func (t *Toki) Match(_, msg string) bool {
 func (t *Toki) SetStore(_ PluginStore) {}
 
 func (t *Toki) fix(msg string) (string, string) {
-	re := regexp.MustCompile(t.Re())
+	re := Compiled(t)
 	return re.ReplaceAllString(msg, "$1"), re.ReplaceAllString(msg, "$2")
 }
 
 // Process does the heavy lifting
-func (t *Toki) Process(from, post string) (string, func() string) {
+func (t *Toki) Process(_ context.Context, _ *MessageContext, post string, _ Emitter) *Response {
 	cmd, w := t.fix(post)
 	cmd = strings.ToLower(cmd)
 	switch cmd {
@@ -4046,9 +4046,9 @@ func (t *Toki) Process(from, post string) (string, func() string) {
 			for _, v := range word {
 				defs = append(defs, v.Print(w))
 			}
-			return strings.Join(defs, "\n\n"), RespStub
+			return Markdown(strings.Join(defs, "\n\n"))
 		} else {
-			return "mi sona ala", RespStub
+			return Markdown("mi sona ala")
 		}
 	case "toki?":
 		st := stemmer.Stem(w)
@@ -4063,15 +4063,13 @@ func (t *Toki) Process(from, post string) (string, func() string) {
 				}
 			}
 		}
-		return strings.Join(words, "\n\n"), RespStub
+		if len(words) == 0 {
+			return Markdown("mi sona ala")
+		}
+		slices.Sort(words)
+		return Results("", words)
 	}
-	return "mi sona ala", RespStub
-}
-
-// RespondText to hi events
-func (t *Toki) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := t.Process(ev.Sender, post)
-	return SendMD(c, ev.RoomID, resp)
+	return Markdown("mi sona ala")
 }
 
 // Name hi
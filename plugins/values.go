@@ -0,0 +1,58 @@
+package plugins
+
+import "suah.dev/mcchunkie/mcstore"
+
+// The helpers below are those of mcstore, for any PluginStore.
+
+// Updater is implemented by stores that can change a key without anyone
+// else writing to it in the meantime, see mcstore.Updater.
+type Updater = mcstore.Updater
+
+// Update replaces the value of key in store with what fn returns for the
+// current one.
+func Update(store PluginStore, key string, fn func(value string) (string, error)) error {
+	return mcstore.Update(store, key, fn)
+}
+
+// Has reports whether key is set in store.
+func Has(store PluginStore, key string) bool {
+	return mcstore.Has(store, key)
+}
+
+// GetJSON decodes the JSON value of key into v.
+func GetJSON(store PluginStore, key string, v any) error {
+	return mcstore.GetJSON(store, key, v)
+}
+
+// SetJSON sets key to v encoded as JSON.
+func SetJSON(store PluginStore, key string, v any) error {
+	return mcstore.SetJSON(store, key, v)
+}
+
+// Incr adds n to the number in key, which starts at 0, and returns the
+// result.
+func Incr(store PluginStore, key string, n int) (int, error) {
+	return mcstore.Incr(store, key, n)
+}
+
+// List returns the entries of the comma separated list in key.
+func List(store PluginStore, key string) []string {
+	return mcstore.List(store, key)
+}
+
+// AddToSet adds the items that aren't in the list in key yet.
+func AddToSet(store PluginStore, key string, items ...string) error {
+	return mcstore.AddToSet(store, key, items...)
+}
+
+// AppendToList adds items to the end of the list in key, even if they are
+// in it already.
+func AppendToList(store PluginStore, key string, items ...string) error {
+	return mcstore.AppendToList(store, key, items...)
+}
+
+// RemoveFromList removes every entry of the list in key that is one of
+// items.
+func RemoveFromList(store PluginStore, key string, items ...string) error {
+	return mcstore.RemoveFromList(store, key, items...)
+}
@@ -0,0 +1,53 @@
+package plugins
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"suah.dev/mcchunkie/mcstore/mcstoretest"
+)
+
+func TestValues(t *testing.T) {
+	main := mcstoretest.Map{}
+	store := Scoped(main, &Beat{})
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Incr(store, "karma_qbit", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _ := Incr(store, "karma_qbit", -1); n != 19 {
+		t.Errorf("expected 19; got %d\n", n)
+	}
+	if v := main["plugins/beat/karma_qbit"]; v != "19" {
+		t.Errorf("expected the counter in the plugin's bucket; got %q\n", v)
+	}
+
+	AddToSet(store, "subscribers", "qbit", "zed")
+	AddToSet(store, "subscribers", "zed", "bob")
+	RemoveFromList(store, "subscribers", "qbit")
+	if got := fmt.Sprint(List(store, "subscribers")); got != "[zed bob]" {
+		t.Errorf("expected [zed bob]; got %s\n", got)
+	}
+	if err := AppendToList(store, "subscribers", "a,b"); err == nil {
+		t.Error("expected an error for an entry with a comma")
+	}
+
+	if err := SetJSON(store, "last", map[string]int{"qbit": 3}); err != nil {
+		t.Fatal(err)
+	}
+	var last map[string]int
+	if err := GetJSON(store, "last", &last); err != nil || last["qbit"] != 3 {
+		t.Errorf("expected to read back the JSON; got %v (%v)\n", last, err)
+	}
+	if Has(store, "missing") || !Has(store, "last") {
+		t.Error("expected Has to tell set and unset keys apart")
+	}
+}
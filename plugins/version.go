@@ -1,11 +1,9 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
 	"runtime"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 var version string
@@ -23,33 +21,28 @@ func (v *Version) Descr() string {
 
 // Re matches version
 func (v *Version) Re() string {
-	return `(?i)version$`
+	return `(?i)version:?$`
 }
 
 // Match checks for "version" anywhere. Might want to tighten this one down at
 // some point
-func (v *Version) Match(user, msg string) bool {
-	re := regexp.MustCompile(v.Re())
-	return re.MatchString(msg) && ToMe(user, msg)
+func (v *Version) Match(mc *MessageContext, msg string) bool {
+	re := Compiled(v)
+	return re.MatchString(msg) && mc.ToMe(msg)
 }
 
 // Process does the heavy lifting
-func (v *Version) Process(_, _ string) (string, func() string) {
-	if version == "" {
-		version = "unknown version"
+func (v *Version) Process(_ context.Context, _ *MessageContext, _ string, _ Emitter) *Response {
+	ver := version
+	if ver == "" {
+		ver = "unknown version"
 	}
-	return fmt.Sprintf(response, version, runtime.GOOS, runtime.Version()), RespStub
+	return Markdown(fmt.Sprintf(response, ver, runtime.GOOS, runtime.Version()))
 }
 
 // SetStore does nothing in here
 func (v *Version) SetStore(_ PluginStore) {}
 
-// RespondText to version events
-func (v *Version) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, _ string) error {
-	resp, _ := v.Process("", "")
-	return SendMD(c, ev.RoomID, resp)
-}
-
 // Name Version
 func (v *Version) Name() string {
 	return "Version"
@@ -1,17 +1,14 @@
 package plugins
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"net/url"
-	"regexp"
 	"strconv"
 	"strings"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // WeatherResp is a JSON response from OpenWeatherMap.org
@@ -129,12 +126,17 @@ type Weather struct {
 	db PluginStore
 }
 
+// Settings lets Weather read the API key
+func (h *Weather) Settings() []string {
+	return []string{"weather_api_key"}
+}
+
 // SetStore is the setup function for a plugin
 func (h *Weather) SetStore(s PluginStore) {
 	h.db = s
 }
 
-func (h *Weather) getPollution(c *CoordResp) (*PollutionResp, error) {
+func (h *Weather) getPollution(ctx context.Context, c *CoordResp) (*PollutionResp, error) {
 	u, err := url.Parse("http://api.openweathermap.org/data/2.5/air_pollution")
 	if err != nil {
 		return nil, err
@@ -155,7 +157,7 @@ func (h *Weather) getPollution(c *CoordResp) (*PollutionResp, error) {
 
 	u.RawQuery = v.Encode()
 
-	resp, err := http.Get(u.String())
+	resp, err := httpGet(ctx, u.String())
 	if err != nil {
 		return nil, err
 	}
@@ -177,7 +179,7 @@ func (h *Weather) getPollution(c *CoordResp) (*PollutionResp, error) {
 	return w, nil
 }
 
-func (h *Weather) getCurrent(loc string) (*WeatherResp, error) {
+func (h *Weather) getCurrent(ctx context.Context, loc string) (*WeatherResp, error) {
 	u := "http://api.openweathermap.org/data/2.5/weather?%s"
 	key, err := h.db.Get("weather_api_key")
 	if err != nil {
@@ -194,7 +196,7 @@ func (h *Weather) getCurrent(loc string) (*WeatherResp, error) {
 
 	u = fmt.Sprintf(u, v.Encode())
 
-	resp, err := http.Get(u)
+	resp, err := httpGet(ctx, u)
 	if err != nil {
 		return nil, err
 	}
@@ -226,47 +228,41 @@ func (h *Weather) Re() string {
 }
 
 // Match checks for "weather: " messages
-func (h *Weather) Match(_, msg string) bool {
-	re := regexp.MustCompile(h.Re())
+func (h *Weather) Match(_ *MessageContext, msg string) bool {
+	re := Compiled(h)
 	return re.MatchString(msg)
 }
 
 func (h *Weather) fix(msg string) string {
-	re := regexp.MustCompile(h.Re())
+	re := Compiled(h)
 	return re.ReplaceAllString(msg, "$1")
 }
 
-func (h *Weather) Process(from, post string) (string, func() string) {
+func (h *Weather) Process(ctx context.Context, mc *MessageContext, post string, _ Emitter) *Response {
 	weather := h.fix(post)
 	if weather != "" {
-		wd, err := h.getCurrent(weather)
+		wd, err := h.getCurrent(ctx, weather)
 		if err != nil {
-			return fmt.Sprintf("sorry %s, I can't look up the weather. %s", from, err), RespStub
+			return Errorf("sorry %s, I can't look up the weather. %s", mc.Name(), err)
 		}
-		po, err := h.getPollution(&wd.Coord)
+		po, err := h.getPollution(ctx, &wd.Coord)
 		if err != nil {
-			return fmt.Sprintf("sorry %s, I can't look up the pollution. %s", from, err), RespStub
+			return Errorf("sorry %s, I can't look up the pollution. %s", mc.Name(), err)
 		}
 
 		pollution := po.String()
 
-		return fmt.Sprintf(`%s: %s (%s) %s, Humidity: %s%%, %s`,
+		return Text(fmt.Sprintf(`%s: %s (%s) %s, Humidity: %s%%, %s`,
 			wd.Name,
 			wd.c(),
 			wd.f(),
 			wd.conditions(),
 			wd.humidity(),
 			pollution,
-		), RespStub
+		))
 	}
 
-	return "shrug.", RespStub
-}
-
-// RespondText to looking up of weather lookup requests
-func (h *Weather) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, _ := h.Process(ev.Sender, post)
-	return SendText(c, ev.RoomID, resp)
+	return Text("shrug.")
 }
 
 // Name Weather!
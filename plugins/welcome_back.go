@@ -1,10 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Wb responds to welcome back messages
@@ -22,24 +20,17 @@ func (h *Wb) Re() string {
 }
 
 // Match determines if we are welcomed back
-func (h *Wb) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
-	return re.MatchString(msg) && ToMe(user, msg)
+func (h *Wb) Match(mc *MessageContext, msg string) bool {
+	re := Compiled(h)
+	return re.MatchString(msg) && mc.ToMe(msg)
 }
 
 // SetStore we don't need a store here
 func (h *Wb) SetStore(_ PluginStore) {}
 
-func (h *Wb) Process(from, post string) (string, func() string) {
-	s := NameRE.ReplaceAllString(from, "$1")
-	return fmt.Sprintf("thanks %s!", s), RespStub
-}
-
-// RespondText to welcome back events
-func (h *Wb) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, _ string) error {
-	resp, _ := h.Process(ev.Sender, "")
-	return SendText(c, ev.RoomID, resp)
-
+func (h *Wb) Process(_ context.Context, mc *MessageContext, post string, _ Emitter) *Response {
+	s := mc.Name()
+	return Text(fmt.Sprintf("thanks %s!", s))
 }
 
 // Name Wb
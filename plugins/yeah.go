@@ -1,11 +1,9 @@
 package plugins
 
 import (
-	"regexp"
+	"context"
 	"strings"
 	"time"
-
-	"github.com/matrix-org/gomatrix"
 )
 
 // Yeah puts on the shades
@@ -26,33 +24,20 @@ func (h *Yeah) Re() string {
 func (h *Yeah) SetStore(_ PluginStore) {}
 
 // Match determines if we should bother giving a high five
-func (h *Yeah) Match(user, msg string) bool {
-	re := regexp.MustCompile(h.Re())
-	return ToMe(user, msg) && re.MatchString(msg)
+func (h *Yeah) Match(mc *MessageContext, msg string) bool {
+	re := Compiled(h)
+	return mc.ToMe(msg) && re.MatchString(msg)
 }
 
-func (h *Yeah) Process(from, post string) (string, func() string) {
+func (h *Yeah) Process(_ context.Context, _ *MessageContext, post string, emit Emitter) *Response {
 	parts := []string{
 		"( •_•)",
 		"( •_•)>⌐■-■",
 		"(⌐■_■)",
 	}
 
-	return strings.Join(parts, "\n"), func() string {
-		time.Sleep(5 * time.Second)
-		return "YEEEAAAAAAHHHHHH!"
-	}
-}
-
-// RespondText to high five events
-func (h *Yeah) RespondText(c *gomatrix.Client, ev *gomatrix.Event, _, post string) error {
-	resp, delayedResp := h.Process(ev.Sender, post)
-	SendText(c, ev.RoomID, resp)
-	go func() {
-		SendText(c, ev.RoomID, delayedResp())
-	}()
-
-	return nil
+	emit.After(5*time.Second, Text("YEEEAAAAAAHHHHHH!"))
+	return Text(strings.Join(parts, "\n"))
 }
 
 // Name returns the name of the Yeah plugin